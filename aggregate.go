@@ -0,0 +1,31 @@
+package histogram
+
+import "context"
+
+// Aggregate folds every histogram received from ch into a new histogram until ch is closed.
+// The first histogram establishes the bucket boundaries and every later one must match them.
+// If ctx is done first, the histograms folded so far are returned with the error of ctx.
+func Aggregate(ctx context.Context, ch <-chan *Histogram) (*Histogram, error) {
+	var accumulated *Histogram
+	for {
+		select {
+		case <-ctx.Done():
+			return accumulated, ctx.Err()
+		case h, ok := <-ch:
+			if !ok {
+				if accumulated == nil {
+					return nil, emptyError
+				}
+				return accumulated, nil
+			}
+			if h == nil {
+				continue
+			}
+			if accumulated == nil {
+				accumulated = h.Copy()
+			} else if err := h.MergeInto(accumulated); err != nil {
+				return accumulated, err
+			}
+		}
+	}
+}
@@ -1,5 +1,13 @@
 package histogram
 
+import (
+	"math"
+	"sort"
+)
+
+// maxGeneratedBoundaries limits the number of boundaries generated by RelativeErrorBoundaries
+const maxGeneratedBoundaries = 1 << 16
+
 func Range(start int64, stop int64, step int64) []int64 {
 	// Step size  cannot be 0
 	// If Step > 0, then start <= stop
@@ -21,3 +29,87 @@ func Range(start int64, stop int64, step int64) []int64 {
 	}
 	return values
 }
+
+func RelativeErrorBoundaries(min int64, max int64, alpha float64) ([]int64, error) {
+	// Boundaries grow geometrically as min * (1 + alpha)^i until max,
+	// so every bucket is at most alpha times wider than its low boundary.
+	// min must be positive, max greater than min and alpha positive but large enough
+	// that 1 + alpha > 1, and at most maxGeneratedBoundaries steps may be needed.
+	if min <= 0 || max <= min || !(alpha > 0) || math.IsInf(alpha, 1) || 1+alpha == 1 {
+		return nil, invalidArgumentError
+	}
+	if math.Log(float64(max)/float64(min))/math.Log1p(alpha) > maxGeneratedBoundaries {
+		return nil, invalidArgumentError
+	}
+	values := []int64{min}
+	for value := float64(min); ; {
+		value *= 1 + alpha
+		rounded := int64(math.Round(value))
+		if value >= float64(max) {
+			break
+		}
+		// Rounding can repeat a boundary at small values, skip duplicates
+		if rounded > values[len(values)-1] {
+			values = append(values, rounded)
+		}
+	}
+	if values[len(values)-1] < max {
+		values = append(values, max)
+	}
+	return values, nil
+}
+
+func SymLogRange(maxAbs int64, decades int) ([]int64, error) {
+	// Boundaries are 0 and, on both sides of it, one boundary per decade
+	// from maxAbs down to maxAbs / 10^(decades-1), e.g. SymLogRange(1000, 3) is
+	// [-1000 -100 -10 0 10 100 1000]. The smallest magnitude must be at least 1.
+	if maxAbs <= 0 || decades < 1 {
+		return nil, invalidArgumentError
+	}
+	positive := make([]int64, decades)
+	value := maxAbs
+	for i := decades - 1; i >= 0; i-- {
+		if value == 0 {
+			return nil, invalidArgumentError
+		}
+		positive[i] = value
+		value /= 10
+	}
+	values := make([]int64, 0, 2*decades+1)
+	for i := decades - 1; i >= 0; i-- {
+		values = append(values, -positive[i])
+	}
+	values = append(values, 0)
+	return append(values, positive...), nil
+}
+
+func CountBalancedBoundaries(samples []int64, minPerBucket int) ([]int64, error) {
+	// Boundaries are placed greedily over the sorted samples, each as soon as the bucket
+	// below it holds minPerBucket samples, so that every bucket including the open ended
+	// first and last buckets would hold at least minPerBucket of the samples.
+	// Sparse regions end up in wide buckets and dense regions in narrow ones.
+	// A boundary cannot split equal samples, so buckets may hold more than minPerBucket.
+	if minPerBucket < 1 {
+		return nil, invalidArgumentError
+	}
+	if len(samples) == 0 {
+		return nil, emptyError
+	}
+	sorted := make([]int64, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var values []int64
+	for j := minPerBucket; j+minPerBucket <= len(sorted); j++ {
+		if sorted[j] > sorted[j-1] {
+			values = append(values, sorted[j])
+			j += minPerBucket - 1
+		}
+	}
+	if len(values) == 0 {
+		// Too few samples or distinct values for two buckets
+		return nil, invalidArgumentError
+	}
+	return values, nil
+}
@@ -0,0 +1,88 @@
+package histogram
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// WriteCSV method writes one row per bucket with the header low,high,count,total,average.
+// The open ends of the first and last buckets are written as -inf and +inf.
+func (h *Histogram) WriteCSV(w io.Writer) error {
+	if h.upperClosed {
+		return upperClosedError
+	}
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"low", "high", "count", "total", "average"})
+	for i := range h.bucketCounts {
+		low, high := h.BucketRanges(i)
+		writer.Write([]string{
+			formatBoundary(low),
+			formatBoundary(high),
+			strconv.FormatInt(h.bucketCounts[i], 10),
+			strconv.FormatInt(h.bucketTotals[i], 10),
+			strconv.FormatFloat(h.BucketAverage(i), 'g', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadCSV reads a histogram in the format written by WriteCSV.
+// Bucket boundaries are taken from the high column, the open ends may be -inf, +inf or empty,
+// and the average column is ignored.
+func ReadCSV(r io.Reader) (*Histogram, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && records[0][0] == "low" {
+		records = records[1:]
+	}
+	if len(records) < 2 {
+		return nil, emptyError
+	}
+	var bucketBoundaries, bucketCounts, bucketTotals []int64
+	for i, record := range records {
+		if len(record) < 4 {
+			return nil, invalidFormatError
+		}
+		first, last := i == 0, i == len(records)-1
+		if first != isOpenEnd(record[0], "-inf") || last != isOpenEnd(record[1], "+inf") {
+			return nil, invalidFormatError
+		}
+		if !last {
+			high, err := strconv.ParseInt(record[1], 10, 64)
+			if err != nil {
+				return nil, invalidFormatError
+			}
+			bucketBoundaries = append(bucketBoundaries, high)
+		}
+		if !first {
+			// Low boundary must match the high boundary of the previous bucket
+			if low, err := strconv.ParseInt(record[0], 10, 64); err != nil || low != bucketBoundaries[i-1] {
+				return nil, invalidFormatError
+			}
+		}
+		count, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return nil, invalidFormatError
+		}
+		total, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return nil, invalidFormatError
+		}
+		bucketCounts = append(bucketCounts, count)
+		bucketTotals = append(bucketTotals, total)
+	}
+	h := &Histogram{}
+	if err := h.setBuckets(bucketBoundaries, bucketCounts, bucketTotals); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// isOpenEnd checks if a boundary cell is the open end or empty
+func isOpenEnd(cell string, openEnd string) bool {
+	return cell == openEnd || cell == ""
+}
@@ -0,0 +1,93 @@
+package histogram
+
+import "sync/atomic"
+
+// WithCumulativeCounts option maintains a Fenwick tree of cumulative bucket counts, which lets
+// Quantile find the bucket of a quantile in O(log buckets) instead of O(buckets). Increment keeps
+// the tree up to date at a cost of O(log buckets) per sample. Other changes of the buckets discard
+// it, Quantile then falls back to a linear walk and the next Increment rebuilds it in O(buckets).
+// Quantile only reads the tree, so it may still be called concurrently with other readers.
+func WithCumulativeCounts() Option {
+	return func(h *Histogram) {
+		h.cumulativeEnabled = true
+		h.buildCumulative()
+	}
+}
+
+// addCumulative method adds count to bucket index of the cumulative counts, rebuilding them first
+// if they were discarded or are out of date. It does nothing unless WithCumulativeCounts is set.
+func (h *Histogram) addCumulative(index int, count int64) {
+	if !h.cumulativeEnabled {
+		return
+	}
+	if !h.cumulativeUpToDate() {
+		h.buildCumulative()
+	}
+	for i := index + 1; i < len(h.cumulativeCounts); i += i & -i {
+		h.cumulativeCounts[i] += count
+	}
+}
+
+// markCumulativeStale method flags the cumulative counts as out of date. It is safe to call
+// concurrently, and stores the flag only if it is not set yet to avoid contended writes.
+func (h *Histogram) markCumulativeStale() {
+	if atomic.LoadInt32(&h.cumulativeStale) == 0 {
+		atomic.StoreInt32(&h.cumulativeStale, 1)
+	}
+}
+
+// cumulativeUpToDate method checks that the cumulative counts match the buckets
+func (h *Histogram) cumulativeUpToDate() bool {
+	return h.cumulativeCounts != nil && atomic.LoadInt32(&h.cumulativeStale) == 0 &&
+		len(h.cumulativeCounts) == len(h.bucketCounts)+1
+}
+
+// cumulativeUsable method checks that the cumulative counts are up to date and can be binary
+// searched, which needs non-negative bucket counts adding up to the number of samples.
+// Increment only adds positive counts to both, so it keeps them searchable.
+func (h *Histogram) cumulativeUsable() bool {
+	return h.cumulativeSearchable && h.cumulativeUpToDate()
+}
+
+// buildCumulative method rebuilds the cumulative counts from the buckets in O(buckets)
+func (h *Histogram) buildCumulative() {
+	atomic.StoreInt32(&h.cumulativeStale, 0)
+	// Element i of the tree holds the sum of the i & -i bucket counts ending at bucket i-1
+	tree := make([]int64, len(h.bucketCounts)+1)
+	searchable := true
+	var numSamples int64
+	for i, count := range h.bucketCounts {
+		if count < 0 {
+			searchable = false
+		}
+		numSamples += count
+		tree[i+1] += count
+		if parent := i + 1 + (i+1)&-(i+1); parent < len(tree) {
+			tree[parent] += tree[i+1]
+		}
+	}
+	h.cumulativeCounts = tree
+	h.cumulativeSearchable = searchable && numSamples == h.numSamples
+}
+
+// searchCumulative method returns the index of the first non-empty bucket whose cumulative count
+// reaches rank, and the fraction of the bucket below rank, like the linear search of quantileBucket.
+// The cumulative counts must be up to date and rank must be in [0, numSamples].
+func (h *Histogram) searchCumulative(rank float64) (int, float64) {
+	n := len(h.cumulativeCounts) - 1
+	step := 1
+	for step*2 <= n {
+		step *= 2
+	}
+	// Find the most buckets whose cumulative count is below rank or zero, the next bucket holds rank
+	index := 0
+	var cumulative int64
+	for ; step > 0; step /= 2 {
+		if next := index + step; next <= n {
+			if sum := cumulative + h.cumulativeCounts[next]; float64(sum) < rank || sum <= 0 {
+				index, cumulative = next, sum
+			}
+		}
+	}
+	return index, (rank - float64(cumulative)) / float64(h.bucketCounts[index])
+}
@@ -0,0 +1,64 @@
+package histogram
+
+import (
+	"math"
+	"sync"
+)
+
+// DecayingHistogram is a histogram where every observation multiplies the existing
+// counts and totals by a decay factor before it is added, so recent samples dominate.
+// Decayed counts and totals are kept as float64 and only rounded to int64 by Current,
+// so small counts still decay instead of being stuck by rounding.
+// All methods are thread-safe, observations are serialized by a mutex.
+type DecayingHistogram struct {
+	mu               sync.Mutex
+	decay            float64
+	bucketBoundaries []int64
+	bucketCounts     []float64
+	bucketTotals     []float64
+}
+
+func NewDecayingHistogram(bucketBoundaries []int64, decay float64) (*DecayingHistogram, error) {
+	if err := validateBoundaries(bucketBoundaries); err != nil {
+		return nil, err
+	}
+	if !(decay > 0 && decay <= 1) {
+		return nil, invalidArgumentError
+	}
+	boundaries := make([]int64, len(bucketBoundaries))
+	copy(boundaries, bucketBoundaries)
+	return &DecayingHistogram{
+		decay:            decay,
+		bucketBoundaries: boundaries,
+		bucketCounts:     make([]float64, len(bucketBoundaries)+1),
+		bucketTotals:     make([]float64, len(bucketBoundaries)+1),
+	}, nil
+}
+
+// Observe method decays the existing samples and inserts a sample
+func (d *DecayingHistogram) Observe(val int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.bucketCounts {
+		d.bucketCounts[i] *= d.decay
+		d.bucketTotals[i] *= d.decay
+	}
+	index := bucketIndex(d.bucketBoundaries, val)
+	d.bucketCounts[index]++
+	d.bucketTotals[index] += float64(val)
+}
+
+// Current method returns a histogram of the decayed samples, with every bucket count and
+// total rounded to the nearest int64. Number of samples and total are the sums of the buckets.
+func (d *DecayingHistogram) Current() *Histogram {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h, _ := New(d.bucketBoundaries)
+	for i := range d.bucketCounts {
+		h.bucketCounts[i] = int64(math.Round(d.bucketCounts[i]))
+		h.bucketTotals[i] = int64(math.Round(d.bucketTotals[i]))
+		h.numSamples += h.bucketCounts[i]
+		h.total += h.bucketTotals[i]
+	}
+	return h
+}
@@ -0,0 +1,65 @@
+package histogram
+
+// WithDistinctCount option keeps the set of distinct values inserted into each bucket with
+// Increment, exposed by BucketDistinct. Memory grows with the number of distinct values,
+// so it is intended for low-cardinality values. Clear and changes to the bucket boundaries
+// restart the tracking, and samples added by AtomicIncrement or other histograms are not tracked.
+func WithDistinctCount() Option {
+	return func(h *Histogram) {
+		h.distinctCount = true
+	}
+}
+
+// BucketDistinct method returns the number of distinct values inserted into this bucket,
+// or 0 if WithDistinctCount is not set
+func (h *Histogram) BucketDistinct(index int) int {
+	if len(h.distinctValues) != len(h.bucketCounts) {
+		return 0
+	}
+	return len(h.distinctValues[index])
+}
+
+// recordDistinct method adds the value to the set of the bucket
+func (h *Histogram) recordDistinct(index int, val int64) {
+	if len(h.distinctValues) != len(h.bucketCounts) {
+		// Bucket boundaries were changed or cleared, restart the tracking
+		h.distinctValues = make([]map[int64]struct{}, len(h.bucketCounts))
+	}
+	if h.distinctValues[index] == nil {
+		h.distinctValues[index] = make(map[int64]struct{})
+	}
+	h.distinctValues[index][val] = struct{}{}
+}
+
+// copyDistinct method returns a deep copy of the sets of distinct values
+func (h *Histogram) copyDistinct() []map[int64]struct{} {
+	if h.distinctValues == nil {
+		return nil
+	}
+	distinctValues := make([]map[int64]struct{}, len(h.distinctValues))
+	for i, values := range h.distinctValues {
+		if values == nil {
+			continue
+		}
+		distinctValues[i] = make(map[int64]struct{}, len(values))
+		for value := range values {
+			distinctValues[i][value] = struct{}{}
+		}
+	}
+	return distinctValues
+}
+
+// mapDistinct method replaces every value of the sets of distinct values with f(value).
+// Values which f maps to the same result are merged.
+func (h *Histogram) mapDistinct(f func(int64) int64) {
+	for i, values := range h.distinctValues {
+		if values == nil {
+			continue
+		}
+		mapped := make(map[int64]struct{}, len(values))
+		for value := range values {
+			mapped[f(value)] = struct{}{}
+		}
+		h.distinctValues[i] = mapped
+	}
+}
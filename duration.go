@@ -0,0 +1,54 @@
+package histogram
+
+import (
+	"math"
+	"time"
+)
+
+// DurationHistogram is a histogram of durations stored as nanoseconds
+type DurationHistogram struct {
+	h *Histogram
+}
+
+func NewDurationHistogram(bucketBoundaries []time.Duration, opts ...Option) (*DurationHistogram, error) {
+	nanoseconds := make([]int64, len(bucketBoundaries))
+	for i, boundary := range bucketBoundaries {
+		nanoseconds[i] = int64(boundary)
+	}
+	h, err := New(nanoseconds, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &DurationHistogram{h: h}, nil
+}
+
+// Observe method inserts a duration into the histogram
+func (d *DurationHistogram) Observe(duration time.Duration) {
+	d.h.Increment(int64(duration))
+}
+
+// Quantile method estimates the duration below which q fraction of the durations fall
+func (d *DurationHistogram) Quantile(q float64) (time.Duration, error) {
+	value, err := d.h.Quantile(q)
+	return time.Duration(value), err
+}
+
+// Average method returns the average of all durations inserted, rounded to nanoseconds
+func (d *DurationHistogram) Average() time.Duration {
+	return time.Duration(math.Round(d.h.Average()))
+}
+
+// Histogram method returns the underlying histogram of nanoseconds
+func (d *DurationHistogram) Histogram() *Histogram {
+	return d.h
+}
+
+// Time method returns a function which inserts the nanoseconds elapsed since Time was called,
+// so a function can be timed with defer h.Time()(). Bucket boundaries must be in nanoseconds.
+// The elapsed time is inserted with AtomicIncrement, so timed functions may run concurrently.
+func (h *Histogram) Time() func() {
+	start := time.Now()
+	return func() {
+		h.AtomicIncrement(int64(time.Since(start)))
+	}
+}
@@ -0,0 +1,137 @@
+package histogram
+
+import (
+	"math"
+	"sort"
+)
+
+// FloatHistogram is a histogram with fractional bucket boundaries.
+// Bucket lookup and totals use float64, but counts stay int64.
+// It follows the same bucket layout as Histogram.
+// Boundaries cannot be NaN or infinite. NaN samples are not stored in any bucket
+// but counted separately, and infinite samples are counted in the open ended
+// first or last bucket without being added to the totals.
+// All operations are not thread-safe.
+type FloatHistogram struct {
+	// Values in half-open range [bucketBoundaries[i-1], bucketBoundaries[i])
+	// will be stored in bucket[i]
+	bucketBoundaries []float64
+	bucketCounts     []int64
+	bucketTotals     []float64
+	numSamples       int64
+	total            float64
+	// nanCount is the number of NaN samples, which are not included in numSamples
+	nanCount int64
+}
+
+func NewFloatBoundaries(bucketBoundaries []float64) (*FloatHistogram, error) {
+	if len(bucketBoundaries) == 0 {
+		return nil, emptyError
+	}
+	for i := 0; i < len(bucketBoundaries); i++ {
+		if math.IsNaN(bucketBoundaries[i]) || math.IsInf(bucketBoundaries[i], 0) {
+			return nil, invalidBoundariesError
+		}
+		if i < len(bucketBoundaries)-1 && bucketBoundaries[i] >= bucketBoundaries[i+1] {
+			return nil, invalidBoundariesError
+		}
+	}
+	// Copy the bucket boundaries so later changes to the slice of the caller do not affect the histogram
+	boundaries := make([]float64, len(bucketBoundaries))
+	copy(boundaries, bucketBoundaries)
+	return &FloatHistogram{
+		bucketBoundaries: boundaries,
+		bucketCounts:     make([]int64, len(bucketBoundaries)+1),
+		bucketTotals:     make([]float64, len(bucketBoundaries)+1),
+	}, nil
+}
+
+// Increment method inserts a sample into the histogram.
+// NaN is only counted by NaNCount, and ±Inf is counted in the open ended bucket
+// but not added to the totals so that they stay finite.
+func (h *FloatHistogram) Increment(val float64) {
+	if math.IsNaN(val) {
+		h.nanCount++
+		return
+	}
+	index := sort.Search(len(h.bucketBoundaries), func(i int) bool {
+		return h.bucketBoundaries[i] > val
+	})
+	h.bucketCounts[index]++
+	h.numSamples++
+	if !math.IsInf(val, 0) {
+		h.bucketTotals[index] += val
+		h.total += val
+	}
+}
+
+// NaNCount method returns the number of NaN samples which were not inserted into any bucket
+func (h *FloatHistogram) NaNCount() int64 {
+	return h.nanCount
+}
+
+// BucketRanges method returns the low and high boundaries of this bucket.
+func (h *FloatHistogram) BucketRanges(index int) (float64, float64) {
+	if index < 0 || index > len(h.bucketBoundaries) {
+		panic("index out of bound")
+	}
+	if index == 0 {
+		return math.Inf(-1), h.bucketBoundaries[index]
+	} else if index == len(h.bucketBoundaries) {
+		return h.bucketBoundaries[index-1], math.Inf(1)
+	} else {
+		return h.bucketBoundaries[index-1], h.bucketBoundaries[index]
+	}
+}
+
+// BucketCount method returns the number of increments that went into this bucket
+func (h *FloatHistogram) BucketCount(index int) int64 {
+	return h.bucketCounts[index]
+}
+
+// BucketTotal method returns the total of all values inserted to a particular bucket
+func (h *FloatHistogram) BucketTotal(index int) float64 {
+	return h.bucketTotals[index]
+}
+
+// BucketAverage method returns the average of all values inserted to a particular bucket.
+func (h *FloatHistogram) BucketAverage(index int) float64 {
+	if h.bucketCounts[index] == 0 {
+		return 0
+	}
+	return h.bucketTotals[index] / float64(h.bucketCounts[index])
+}
+
+// Size method returns the number of buckets
+func (h *FloatHistogram) Size() int {
+	return len(h.bucketCounts)
+}
+
+// Count method returns the total number of samples in all buckets
+func (h *FloatHistogram) Count() int64 {
+	return h.numSamples
+}
+
+// Total method returns the sum of all samples inserted into the histogram
+func (h *FloatHistogram) Total() float64 {
+	return h.total
+}
+
+// Average method returns the average of all values inserted
+func (h *FloatHistogram) Average() float64 {
+	if h.numSamples == 0 {
+		return 0
+	}
+	return h.total / float64(h.numSamples)
+}
+
+// Clear method zeros out the buckets
+func (h *FloatHistogram) Clear() {
+	for i := range h.bucketCounts {
+		h.bucketCounts[i] = 0
+		h.bucketTotals[i] = 0
+	}
+	h.numSamples = 0
+	h.total = 0
+	h.nanCount = 0
+}
@@ -0,0 +1,59 @@
+package histogram
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Format method implements fmt.Formatter.
+//
+//	%v  prints a compact summary
+//	    count=4 mean=2.5 p50=2 p99=3
+//	%+v prints one line per bucket with its range, count, total and average
+//	    [-inf, 1) count=1 total=0 average=0
+//	    or (-inf, 1] count=1 total=0 average=0 with WithUpperClosed
+//	%#v prints a Go-syntax representation of the histogram
+//	    &histogram.Histogram{bucketBoundaries:[]int64{1}, bucketCounts:[]int64{1, 0}, ...}
+func (h *Histogram) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		fmt.Fprintf(f, "&histogram.Histogram{bucketBoundaries:%#v, bucketCounts:%#v, bucketTotals:%#v, numSamples:%d, total:%d}",
+			h.bucketBoundaries, h.bucketCounts, h.bucketTotals, h.numSamples, h.total)
+	case verb == 'v' && f.Flag('+'):
+		for i := range h.bucketCounts {
+			if i > 0 {
+				fmt.Fprintln(f)
+			}
+			fmt.Fprintf(f, "%s count=%d total=%d average=%g",
+				h.formatRange(i), h.bucketCounts[i], h.bucketTotals[i], h.BucketAverage(i))
+		}
+	case verb == 'v' || verb == 's':
+		fmt.Fprintf(f, "count=%d mean=%g", h.numSamples, h.Average())
+		if p50, err := h.Quantile(0.5); err == nil {
+			p99, _ := h.Quantile(0.99)
+			fmt.Fprintf(f, " p50=%d p99=%d", p50, p99)
+		}
+	default:
+		fmt.Fprintf(f, "%%!%c(*histogram.Histogram)", verb)
+	}
+}
+
+// formatBoundary returns the boundary as a string, open ends are printed as -inf and +inf
+func formatBoundary(boundary int64) string {
+	if boundary == math.MinInt64 {
+		return "-inf"
+	} else if boundary == math.MaxInt64 {
+		return "+inf"
+	}
+	return strconv.FormatInt(boundary, 10)
+}
+
+// formatRange returns the range of bucket index with brackets showing the boundary it includes
+func (h *Histogram) formatRange(index int) string {
+	low, high := h.BucketRanges(index)
+	if h.upperClosed {
+		return "(" + formatBoundary(low) + ", " + formatBoundary(high) + "]"
+	}
+	return "[" + formatBoundary(low) + ", " + formatBoundary(high) + ")"
+}
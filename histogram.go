@@ -1,7 +1,10 @@
 package histogram
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"math"
 	"sort"
 	"sync/atomic"
@@ -14,7 +17,7 @@ import (
 // Values greater than last bucket boundary are store in last bucket.
 // Bucket boundaries must be sorted and all values must be different.
 // Negative boundaries are okay.
-// All operations are not thread-safe except AtomicIncrement.
+// All operations are not thread-safe except the methods prefixed with Atomic, DrainTo and SwapAndReset.
 // Note: User must make sure that index is valid for all methods which uses an index
 // index must belong to [0, len(bucketBoundaries)]
 type Histogram struct {
@@ -30,54 +33,264 @@ type Histogram struct {
 	// computation of an average
 	numSamples int64
 	total      int64
+	// sumOfSquares tracks the sum of squares of the samples to allow computation of variance.
+	// It overflows when the squares add up to more than math.MaxInt64, a single
+	// sample overflows it if its magnitude exceeds about 3 billion.
+	sumOfSquares int64
+	// bucketLabels optionally names each bucket, it is nil or the same size as bucketCounts
+	bucketLabels []string
+	// reservoir retains the first reservoirSize raw samples inserted with Increment
+	reservoirSize int
+	reservoir     []int64
+	// topValues is a min-heap of the topK largest samples inserted with Increment
+	topK      int
+	topValues minHeap
+	// clampValues makes Increment and AtomicIncrement clamp values to the finite range
+	clampValues bool
+	// upperClosed makes buckets hold values in (bucketBoundaries[i-1], bucketBoundaries[i]]
+	upperClosed bool
+	// rejected is the number of values dropped by IncrementOrReject
+	rejected int64
+	// distinctValues holds the set of values inserted into each bucket if distinctCount is set
+	distinctCount  bool
+	distinctValues []map[int64]struct{}
+	// cumulativeCounts is a Fenwick tree over bucketCounts maintained if cumulativeEnabled is set,
+	// which lets Quantile find the bucket of a rank in O(log buckets). Increment keeps it up to date
+	// and rebuilds it after other changes of the buckets discard it. The Atomic methods, DrainTo and
+	// SwapAndReset may run concurrently, so instead of discarding it they atomically set
+	// cumulativeStale to 1. cumulativeSearchable is false if it cannot be binary searched.
+	cumulativeEnabled    bool
+	cumulativeCounts     []int64
+	cumulativeSearchable bool
+	cumulativeStale      int32
 }
 
 var (
 	emptyError             = errors.New("Slice is empty")
 	invalidBoundariesError = errors.New("Invalid bucket boundaries")
+	invalidLengthsError    = errors.New("Invalid lengths of bucket counts or totals")
+	invalidFormatError     = errors.New("Invalid format")
+	mismatchError          = errors.New("Mismatch in bucket boundaries")
+	invalidQuantileError   = errors.New("Invalid quantile")
+	invalidLabelsError     = errors.New("Invalid number of bucket labels")
+	nonEmptyBucketError    = errors.New("Bucket is not empty")
+	overflowError          = errors.New("Integer overflow")
+	invalidArgumentError   = errors.New("Invalid argument")
+	indexOutOfBoundError   = errors.New("Index out of bound")
+	negativeCountError     = errors.New("Negative bucket count")
+	inconsistentTotalError = errors.New("Bucket total is inconsistent with bucket count")
+	noSamplesError         = errors.New("Histogram is empty")
+	unsortedError          = errors.New("Values are not sorted")
+	inconsistentSumError   = errors.New("Sum of buckets is inconsistent with aggregate")
+	upperClosedError       = errors.New("Upper closed buckets cannot be encoded")
 )
 
-func New(bucketBoundaries []int64) (*Histogram, error) {
-	if bucketBoundaries == nil {
+// validateBoundaries checks that bucketBoundaries are non-empty and strictly increasing
+func validateBoundaries(bucketBoundaries []int64) error {
+	if len(bucketBoundaries) == 0 {
 		// length of bucketBoundaries must be atleast one
-		return nil, emptyError
+		return emptyError
 	}
 	for i := 0; i < len(bucketBoundaries)-1; i++ {
 		// Check if the bucketBoundaries are in sorted order
 		// and are strictly increasing
 		if bucketBoundaries[i] >= bucketBoundaries[i+1] {
-			return nil, invalidBoundariesError
+			return invalidBoundariesError
 		}
 	}
-	return &Histogram{
-		bucketBoundaries: bucketBoundaries,
+	return nil
+}
+
+// setBuckets method validates and replaces the state of the histogram.
+// Number of samples and total are recomputed from the bucket counts and totals.
+func (h *Histogram) setBuckets(bucketBoundaries, bucketCounts, bucketTotals []int64) error {
+	if err := validateBoundaries(bucketBoundaries); err != nil {
+		return err
+	}
+	if len(bucketCounts) != len(bucketBoundaries)+1 || len(bucketTotals) != len(bucketBoundaries)+1 {
+		return invalidLengthsError
+	}
+	h.bucketBoundaries = bucketBoundaries
+	h.bucketCounts = bucketCounts
+	h.bucketTotals = bucketTotals
+	h.bucketLabels = nil
+	h.cumulativeCounts = nil
+	// Samples retained by Increment no longer belong to the buckets
+	h.reservoir = h.reservoir[:0]
+	h.topValues = h.topValues[:0]
+	h.distinctValues = nil
+	h.numSamples = 0
+	h.total = 0
+	h.sumOfSquares = 0
+	for i := range bucketCounts {
+		h.numSamples += bucketCounts[i]
+		h.total += bucketTotals[i]
+	}
+	return nil
+}
+
+func New(bucketBoundaries []int64, opts ...Option) (*Histogram, error) {
+	if err := validateBoundaries(bucketBoundaries); err != nil {
+		return nil, err
+	}
+	// Copy the bucket boundaries so later changes to the slice of the caller do not affect the histogram
+	boundaries := make([]int64, len(bucketBoundaries))
+	copy(boundaries, bucketBoundaries)
+	h := &Histogram{
+		bucketBoundaries: boundaries,
 		bucketCounts:     make([]int64, len(bucketBoundaries)+1),
 		bucketTotals:     make([]int64, len(bucketBoundaries)+1),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
 }
 
-// Increment method inserts a sample into the histogram
-func (h *Histogram) Increment(val int64) {
+// NewSorted creates a histogram from bucket boundaries in any order.
+// Bucket boundaries are copied before sorting so the slice of the caller is not modified.
+// Bucket boundaries must still be all different.
+func NewSorted(bucketBoundaries []int64, opts ...Option) (*Histogram, error) {
+	sorted := make([]int64, len(bucketBoundaries))
+	copy(sorted, bucketBoundaries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return New(sorted, opts...)
+}
+
+// FromCounts creates a histogram holding pre-counted bucket counts and totals, such as aggregations
+// computed elsewhere. There must be one more bucket count and bucket total than bucket boundaries,
+// and number of samples and total are the sums of the bucket counts and totals.
+// All slices are copied so later changes to the slices of the caller do not affect the histogram.
+func FromCounts(bucketBoundaries, bucketCounts, bucketTotals []int64) (*Histogram, error) {
+	h := &Histogram{}
+	err := h.setBuckets(
+		append(make([]int64, 0, len(bucketBoundaries)), bucketBoundaries...),
+		append(make([]int64, 0, len(bucketCounts)), bucketCounts...),
+		append(make([]int64, 0, len(bucketTotals)), bucketTotals...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// BucketIndex method returns the index of the bucket the value falls into
+func (h *Histogram) BucketIndex(val int64) int {
+	if h.upperClosed {
+		// A value falls into a bucket i if it is in (bucketBoundaries[i-1], bucketBoundaries[i]]
+		return sort.Search(len(h.bucketBoundaries), func(i int) bool {
+			return h.bucketBoundaries[i] >= val
+		})
+	}
+	return bucketIndex(h.bucketBoundaries, val)
+}
+
+// bucketIndex returns the index of the bucket the value falls into
+func bucketIndex(bucketBoundaries []int64, val int64) int {
 	// A value falls into a bucket i if it is in [bucketBoundaries[i-1], bucketBoundaries[i])
 	// Search does a binary search to find the smallest index that matches the search condition
-	index := sort.Search(len(h.bucketBoundaries), func(i int) bool {
-		return h.bucketBoundaries[i] > val
+	return sort.Search(len(bucketBoundaries), func(i int) bool {
+		return bucketBoundaries[i] > val
 	})
+}
+
+// Increment method inserts a sample into the histogram
+func (h *Histogram) Increment(val int64) {
+	if h.clampValues {
+		val = h.clamp(val)
+	}
+	h.incrementBucket(h.BucketIndex(val), val)
+}
+
+// incrementBucket method inserts a sample known to fall into bucket index
+func (h *Histogram) incrementBucket(index int, val int64) {
+	h.addCumulative(index, 1)
 	h.bucketCounts[index]++
 	h.bucketTotals[index] += val
 	h.numSamples++
 	h.total += val
+	h.sumOfSquares += val * val
+	if len(h.reservoir) < h.reservoirSize {
+		h.reservoir = append(h.reservoir, val)
+	}
+	if h.topK > 0 {
+		h.recordTopK(val)
+	}
+	if h.distinctCount {
+		h.recordDistinct(index, val)
+	}
+}
+
+// IncrementSampled method inserts a sample observed with given sampling rate, so that it stands for
+// 1/sampleRate samples of the full population. The weight 1/sampleRate is rounded to the nearest
+// integer, which is added to the bucket count while the value times the weight is added to the totals.
+// The sample is not retained in the reservoir. sampleRate must be in (0, 1].
+func (h *Histogram) IncrementSampled(val int64, sampleRate float64) {
+	if !(sampleRate > 0 && sampleRate <= 1) {
+		panic("sample rate out of range")
+	}
+	weight := int64(math.Round(1 / sampleRate))
+	if h.clampValues {
+		val = h.clamp(val)
+	}
+	index := h.BucketIndex(val)
+	h.addCumulative(index, weight)
+	h.bucketCounts[index] += weight
+	h.bucketTotals[index] += val * weight
+	h.numSamples += weight
+	h.total += val * weight
+	h.sumOfSquares += val * val * weight
+	if h.distinctCount {
+		h.recordDistinct(index, val)
+	}
+}
+
+// IncrementClamped method inserts a sample clamped to [bucketBoundaries[0], bucketBoundaries[last]].
+// The clamped value is added to the totals instead of the raw value.
+func (h *Histogram) IncrementClamped(val int64) {
+	h.Increment(h.clamp(val))
+}
+
+// clamp method limits the value to [bucketBoundaries[0], bucketBoundaries[last]]
+func (h *Histogram) clamp(val int64) int64 {
+	if val < h.bucketBoundaries[0] {
+		return h.bucketBoundaries[0]
+	} else if last := h.bucketBoundaries[len(h.bucketBoundaries)-1]; val > last {
+		return last
+	}
+	return val
 }
 
-// AtomicIncrement method inserts a sample into the histogram in thread safe manner
+// IncrementOrReject method inserts a sample if valid returns true for it,
+// otherwise the sample is dropped and counted by Rejected
+func (h *Histogram) IncrementOrReject(val int64, valid func(int64) bool) {
+	if !valid(val) {
+		h.rejected++
+		return
+	}
+	h.Increment(val)
+}
+
+// Rejected method returns the number of samples dropped by IncrementOrReject
+func (h *Histogram) Rejected() int64 {
+	return h.rejected
+}
+
+// AtomicIncrement method inserts a sample into the histogram in thread safe manner.
+// The sample is not retained in the reservoir.
 func (h *Histogram) AtomicIncrement(val int64) {
-	index := sort.Search(len(h.bucketBoundaries), func(i int) bool {
-		return h.bucketBoundaries[i] > val
-	})
+	if h.clampValues {
+		val = h.clamp(val)
+	}
+	index := h.BucketIndex(val)
+	h.markCumulativeStale()
 	atomic.AddInt64(&h.bucketCounts[index], 1)
 	atomic.AddInt64(&h.bucketTotals[index], val)
 	atomic.AddInt64(&h.numSamples, 1)
 	atomic.AddInt64(&h.total, val)
+	atomic.AddInt64(&h.sumOfSquares, val*val)
 }
 
 // BucketRanges method returns the low and high boundaries of this bucket.
@@ -94,11 +307,75 @@ func (h *Histogram) BucketRanges(index int) (int64, int64) {
 	}
 }
 
+// BucketRangesErr method is like BucketRanges but returns an error for an invalid index
+func (h *Histogram) BucketRangesErr(index int) (low, high int64, err error) {
+	if !h.validIndex(index) {
+		return 0, 0, indexOutOfBoundError
+	}
+	low, high = h.BucketRanges(index)
+	return low, high, nil
+}
+
+// BucketCountErr method is like BucketCount but returns an error for an invalid index
+func (h *Histogram) BucketCountErr(index int) (int64, error) {
+	if !h.validIndex(index) {
+		return 0, indexOutOfBoundError
+	}
+	return h.BucketCount(index), nil
+}
+
+// BucketTotalErr method is like BucketTotal but returns an error for an invalid index
+func (h *Histogram) BucketTotalErr(index int) (int64, error) {
+	if !h.validIndex(index) {
+		return 0, indexOutOfBoundError
+	}
+	return h.BucketTotal(index), nil
+}
+
+// BucketAverageErr method is like BucketAverage but returns an error for an invalid index
+func (h *Histogram) BucketAverageErr(index int) (float64, error) {
+	if !h.validIndex(index) {
+		return 0, indexOutOfBoundError
+	}
+	return h.BucketAverage(index), nil
+}
+
+// validIndex method checks that index belongs to [0, len(bucketBoundaries)]
+func (h *Histogram) validIndex(index int) bool {
+	return index >= 0 && index <= len(h.bucketBoundaries)
+}
+
+// ForEachBucket method calls fn with the range, count and total of each bucket from first to last
+func (h *Histogram) ForEachBucket(fn func(index int, low, high, count, total int64)) {
+	for i := 0; i < len(h.bucketCounts); i++ {
+		low, high := h.BucketRanges(i)
+		fn(i, low, high, h.bucketCounts[i], h.bucketTotals[i])
+	}
+}
+
+// ForEachBucketReverse method calls fn with the range, count and total of each bucket from last to first
+func (h *Histogram) ForEachBucketReverse(fn func(index int, low, high, count, total int64)) {
+	for i := len(h.bucketCounts) - 1; i >= 0; i-- {
+		low, high := h.BucketRanges(i)
+		fn(i, low, high, h.bucketCounts[i], h.bucketTotals[i])
+	}
+}
+
 // BucketCount method returns the number of increments that went into this bucket
 func (h *Histogram) BucketCount(index int) int64 {
 	return h.bucketCounts[index]
 }
 
+// CountAt method returns the number of increments that went into the bucket val falls into
+func (h *Histogram) CountAt(val int64) int64 {
+	return h.bucketCounts[h.BucketIndex(val)]
+}
+
+// RangeAt method returns the low and high boundaries of the bucket val falls into, like BucketRanges
+func (h *Histogram) RangeAt(val int64) (low, high int64) {
+	return h.BucketRanges(h.BucketIndex(val))
+}
+
 // BucketTotal method returns the total of all values inserted to a particular bucket
 func (h *Histogram) BucketTotal(index int) int64 {
 	return h.bucketTotals[index]
@@ -112,14 +389,165 @@ func (h *Histogram) BucketAverage(index int) float64 {
 	return float64(h.bucketTotals[index]) / float64(h.bucketCounts[index])
 }
 
+// UnderflowCount method returns the number of samples less than the first bucket boundary.
+// The open ended first and last buckets are dedicated to the samples outside the finite range,
+// so they never affect the counts, totals or averages of the finite buckets. WithClampValues and
+// IncrementClamped are the exception, they move the samples into the buckets at the boundaries.
+func (h *Histogram) UnderflowCount() int64 {
+	return h.bucketCounts[0]
+}
+
+// OverflowCount method returns the number of samples not less than the last bucket boundary
+func (h *Histogram) OverflowCount() int64 {
+	return h.bucketCounts[len(h.bucketCounts)-1]
+}
+
+// UnderflowTotal method returns the total of samples less than the first bucket boundary
+func (h *Histogram) UnderflowTotal() int64 {
+	return h.bucketTotals[0]
+}
+
+// OverflowTotal method returns the total of samples not less than the last bucket boundary
+func (h *Histogram) OverflowTotal() int64 {
+	return h.bucketTotals[len(h.bucketTotals)-1]
+}
+
+// FiniteFraction method returns the fraction of samples in the finite buckets, which are neither
+// underflow nor overflow. Estimates from the buckets are unreliable when it is far below 1.
+// It returns 0 if the histogram is empty.
+func (h *Histogram) FiniteFraction() float64 {
+	if h.IsEmpty() {
+		return 0
+	}
+	finite := h.numSamples - h.UnderflowCount() - h.OverflowCount()
+	return float64(finite) / float64(h.numSamples)
+}
+
+// MaxTotalBucket method returns the index of the bucket with the largest total.
+// The lowest index wins ties, and ok is false if the histogram is empty.
+func (h *Histogram) MaxTotalBucket() (index int, ok bool) {
+	if h.IsEmpty() {
+		return 0, false
+	}
+	for i := range h.bucketTotals {
+		if h.bucketTotals[i] > h.bucketTotals[index] {
+			index = i
+		}
+	}
+	return index, true
+}
+
+// Peaks method returns the indices of buckets whose count exceeds the counts of both
+// neighboring buckets by at least minProminence fraction of the largest bucket count.
+// Missing neighbors of the first and last buckets are treated as empty.
+func (h *Histogram) Peaks(minProminence float64) []int {
+	var maxCount int64
+	for _, count := range h.bucketCounts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+	var peaks []int
+	if maxCount == 0 {
+		return peaks
+	}
+	threshold := minProminence * float64(maxCount)
+	for i, count := range h.bucketCounts {
+		var left, right int64
+		if i > 0 {
+			left = h.bucketCounts[i-1]
+		}
+		if i < len(h.bucketCounts)-1 {
+			right = h.bucketCounts[i+1]
+		}
+		if count > left && count > right &&
+			float64(count-left) >= threshold && float64(count-right) >= threshold {
+			peaks = append(peaks, i)
+		}
+	}
+	return peaks
+}
+
+// SetLabels method names each bucket, number of labels must be same as Size.
+// Labels are kept by Clear and carried over by Copy.
+func (h *Histogram) SetLabels(labels []string) error {
+	if len(labels) != h.Size() {
+		return invalidLabelsError
+	}
+	h.bucketLabels = make([]string, len(labels))
+	copy(h.bucketLabels, labels)
+	return nil
+}
+
+// BucketLabel method returns the label of this bucket, or empty string if labels are not set
+func (h *Histogram) BucketLabel(index int) string {
+	if h.bucketLabels == nil {
+		return ""
+	}
+	return h.bucketLabels[index]
+}
+
+// AtomicBucketAverage method returns the average of all values inserted to a particular bucket
+// while other goroutines call AtomicIncrement. Count and total are loaded atomically but
+// separately, so an increment between the two loads can make the average slightly off.
+func (h *Histogram) AtomicBucketAverage(index int) float64 {
+	total := atomic.LoadInt64(&h.bucketTotals[index])
+	count := atomic.LoadInt64(&h.bucketCounts[index])
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
+// MinBucketWidth method returns the width of the narrowest finite bucket,
+// or 0 if there is only one bucket boundary
+func (h *Histogram) MinBucketWidth() int64 {
+	var width int64
+	for i := 1; i < len(h.bucketBoundaries); i++ {
+		if w := h.bucketBoundaries[i] - h.bucketBoundaries[i-1]; i == 1 || w < width {
+			width = w
+		}
+	}
+	return width
+}
+
+// MaxBucketWidth method returns the width of the widest finite bucket,
+// or 0 if there is only one bucket boundary
+func (h *Histogram) MaxBucketWidth() int64 {
+	var width int64
+	for i := 1; i < len(h.bucketBoundaries); i++ {
+		if w := h.bucketBoundaries[i] - h.bucketBoundaries[i-1]; w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// lengthsConsistent method checks that there is one more bucket count and bucket total than
+// bucket boundaries, the invariant every operation changing the buckets must keep
+func (h *Histogram) lengthsConsistent() bool {
+	return len(h.bucketCounts) == len(h.bucketBoundaries)+1 && len(h.bucketTotals) == len(h.bucketBoundaries)+1
+}
+
 // Size method returns the number of buckets
 func (h *Histogram) Size() int {
-	if len(h.bucketCounts) != len(h.bucketTotals) {
-		panic("Mismatch in lengths of bucketCounts and bucketTotals")
+	if !h.lengthsConsistent() {
+		panic("Mismatch in lengths of bucketBoundaries, bucketCounts and bucketTotals")
 	}
 	return len(h.bucketCounts)
 }
 
+// OccupiedBuckets method returns the number of buckets with at least one sample
+func (h *Histogram) OccupiedBuckets() int {
+	occupied := 0
+	for _, count := range h.bucketCounts {
+		if count > 0 {
+			occupied++
+		}
+	}
+	return occupied
+}
+
 // Count method returns the total number of samples in all buckets
 func (h *Histogram) Count() int64 {
 	return h.numSamples
@@ -130,18 +558,68 @@ func (h *Histogram) Total() int64 {
 	return h.total
 }
 
+// Variance method returns the population variance of all values inserted.
+// It relies on the sum of squares of the samples, which overflows when the squares
+// add up to more than math.MaxInt64.
+func (h *Histogram) Variance() float64 {
+	if h.IsEmpty() {
+		return 0
+	}
+	mean := h.Average()
+	variance := float64(h.sumOfSquares)/float64(h.numSamples) - mean*mean
+	if variance < 0 {
+		// Rounding errors can make the variance of nearly identical samples negative
+		return 0
+	}
+	return variance
+}
+
+// StdDev method returns the population standard deviation of all values inserted
+func (h *Histogram) StdDev() float64 {
+	return math.Sqrt(h.Variance())
+}
+
+// CoefficientOfVariation method returns StdDev divided by Average, which compares the variability
+// of histograms with different scales. It is 0 if the average is 0.
+func (h *Histogram) CoefficientOfVariation() float64 {
+	average := h.Average()
+	if average == 0 {
+		return 0
+	}
+	return h.StdDev() / average
+}
+
+// IsEmpty method returns true if there are no samples in the histogram.
+// Number of samples can become negative after DecrementFromHistogram, which is also treated as empty.
+func (h *Histogram) IsEmpty() bool {
+	return h.numSamples <= 0
+}
+
 // Average method returns the average of all values inserted
 func (h *Histogram) Average() float64 {
-	if h.numSamples == 0 {
+	if h.IsEmpty() {
 		return float64(0)
 	}
 	return float64(h.total) / float64(h.numSamples)
 }
 
+// Probabilities method returns the fraction of samples in each bucket.
+// The fractions sum to 1, or are all zero if the histogram is empty.
+func (h *Histogram) Probabilities() []float64 {
+	probabilities := make([]float64, len(h.bucketCounts))
+	if h.IsEmpty() {
+		return probabilities
+	}
+	for i, count := range h.bucketCounts {
+		probabilities[i] = float64(count) / float64(h.numSamples)
+	}
+	return probabilities
+}
+
 // Clear method zeros out the buckets
 func (h *Histogram) Clear() {
-	if len(h.bucketCounts) != len(h.bucketTotals) {
-		panic("Mismatch in lengths of bucketCounts and bucketTotals")
+	if !h.lengthsConsistent() {
+		panic("Mismatch in lengths of bucketBoundaries, bucketCounts and bucketTotals")
 	}
 	for i := range h.bucketCounts {
 		h.bucketCounts[i] = 0
@@ -149,11 +627,18 @@ func (h *Histogram) Clear() {
 		h.numSamples = 0
 		h.total = 0
 	}
+	h.sumOfSquares = 0
+	h.rejected = 0
+	h.reservoir = h.reservoir[:0]
+	h.topValues = h.topValues[:0]
+	h.distinctValues = nil
+	h.cumulativeCounts = nil
 }
 
 // IncrementFromHistogram method includes all the samples of other histogram into this.
 // This bucketBoundaries used to construct other histogram must be identical to this.
 func (h *Histogram) IncrementFromHistogram(other *Histogram) {
+	h.cumulativeCounts = nil
 	if len(other.bucketBoundaries) != len(h.bucketBoundaries) {
 		panic("Mismatch in sizes of  bucketBoundaries")
 	}
@@ -163,10 +648,146 @@ func (h *Histogram) IncrementFromHistogram(other *Histogram) {
 	}
 	h.numSamples += other.numSamples
 	h.total += other.total
+	h.sumOfSquares += other.sumOfSquares
+}
+
+// AtomicIncrementFromHistogram method includes all the samples of other histogram into this
+// in thread safe manner. Each bucket and aggregate is added atomically, but the histogram
+// as a whole is not updated in a single atomic step.
+// This bucketBoundaries used to construct other histogram must be identical to this.
+func (h *Histogram) AtomicIncrementFromHistogram(other *Histogram) {
+	if !h.sameBoundaries(other) {
+		panic("Mismatch in bucketBoundaries")
+	}
+	h.markCumulativeStale()
+	for i := 0; i < len(h.bucketCounts); i++ {
+		atomic.AddInt64(&h.bucketCounts[i], other.bucketCounts[i])
+		atomic.AddInt64(&h.bucketTotals[i], other.bucketTotals[i])
+	}
+	atomic.AddInt64(&h.numSamples, other.numSamples)
+	atomic.AddInt64(&h.total, other.total)
+	atomic.AddInt64(&h.sumOfSquares, other.sumOfSquares)
+}
+
+// MergeInto method includes all the samples of this histogram into dest without allocating.
+// Unlike IncrementFromHistogram it returns an error if the bucket boundaries are not identical.
+func (h *Histogram) MergeInto(dest *Histogram) error {
+	if !h.sameBoundaries(dest) {
+		return mismatchError
+	}
+	dest.IncrementFromHistogram(h)
+	return nil
+}
+
+// FoldInto method includes all the samples of this histogram into coarse, whose bucket boundaries
+// must be a subset of this. Every bucket of this lies wholly within a bucket of coarse, so no
+// interpolation is needed.
+func (h *Histogram) FoldInto(coarse *Histogram) error {
+	if h.upperClosed != coarse.upperClosed {
+		return mismatchError
+	}
+	coarse.cumulativeCounts = nil
+	j := 0
+	for _, boundary := range coarse.bucketBoundaries {
+		for j < len(h.bucketBoundaries) && h.bucketBoundaries[j] < boundary {
+			j++
+		}
+		if j == len(h.bucketBoundaries) || h.bucketBoundaries[j] != boundary {
+			return mismatchError
+		}
+	}
+	for i := range h.bucketCounts {
+		target := 0
+		if i > 0 {
+			target = bucketIndex(coarse.bucketBoundaries, h.bucketBoundaries[i-1])
+		}
+		coarse.bucketCounts[target] += h.bucketCounts[i]
+		coarse.bucketTotals[target] += h.bucketTotals[i]
+	}
+	coarse.numSamples += h.numSamples
+	coarse.total += h.total
+	coarse.sumOfSquares += h.sumOfSquares
+	return nil
+}
+
+// DrainTo method moves all the samples of this histogram into dest and clears this.
+// It is safe to use while other goroutines call AtomicIncrement on either histogram.
+// Every bucket and aggregate is atomically swapped with zero and added to dest,
+// so no sample is lost or counted twice, although a concurrent increment may be
+// split between this drain and the next one.
+// This bucketBoundaries used to construct dest histogram must be identical to this.
+func (h *Histogram) DrainTo(dest *Histogram) error {
+	if !h.sameBoundaries(dest) {
+		return mismatchError
+	}
+	h.markCumulativeStale()
+	dest.markCumulativeStale()
+	for i := 0; i < len(h.bucketCounts); i++ {
+		atomic.AddInt64(&dest.bucketCounts[i], atomic.SwapInt64(&h.bucketCounts[i], 0))
+		atomic.AddInt64(&dest.bucketTotals[i], atomic.SwapInt64(&h.bucketTotals[i], 0))
+	}
+	atomic.AddInt64(&dest.numSamples, atomic.SwapInt64(&h.numSamples, 0))
+	atomic.AddInt64(&dest.total, atomic.SwapInt64(&h.total, 0))
+	atomic.AddInt64(&dest.sumOfSquares, atomic.SwapInt64(&h.sumOfSquares, 0))
+	return nil
+}
+
+// SwapAndReset method returns a new histogram holding the samples of this histogram and zeros this
+// histogram, swapping each bucket and aggregate atomically so it may be called while other goroutines
+// call AtomicIncrement. Every sample is counted exactly once in either histogram, though a sample
+// inserted concurrently may have its bucket in one and its contribution to the aggregates in the other.
+// The returned histogram keeps the bucket boundaries and the clamping and upper-closed options.
+func (h *Histogram) SwapAndReset() *Histogram {
+	bucketBoundaries := make([]int64, len(h.bucketBoundaries))
+	copy(bucketBoundaries, h.bucketBoundaries)
+	var bucketLabels []string
+	if h.bucketLabels != nil {
+		bucketLabels = make([]string, len(h.bucketLabels))
+		copy(bucketLabels, h.bucketLabels)
+	}
+	swapped := &Histogram{
+		bucketBoundaries:  bucketBoundaries,
+		bucketCounts:      make([]int64, len(h.bucketCounts)),
+		bucketTotals:      make([]int64, len(h.bucketTotals)),
+		bucketLabels:      bucketLabels,
+		clampValues:       h.clampValues,
+		upperClosed:       h.upperClosed,
+		cumulativeEnabled: h.cumulativeEnabled,
+	}
+	h.markCumulativeStale()
+	for i := range h.bucketCounts {
+		swapped.bucketCounts[i] = atomic.SwapInt64(&h.bucketCounts[i], 0)
+		swapped.bucketTotals[i] = atomic.SwapInt64(&h.bucketTotals[i], 0)
+	}
+	swapped.numSamples = atomic.SwapInt64(&h.numSamples, 0)
+	swapped.total = atomic.SwapInt64(&h.total, 0)
+	swapped.sumOfSquares = atomic.SwapInt64(&h.sumOfSquares, 0)
+	return swapped
+}
+
+// sameBoundaries method checks if other histogram has identical bucket boundaries.
+// Buckets of histograms differing in WithUpperClosed hold different values even with identical
+// bucket boundaries, so they are not considered the same.
+func (h *Histogram) sameBoundaries(other *Histogram) bool {
+	return h.upperClosed == other.upperClosed && equalBoundaries(h.bucketBoundaries, other.bucketBoundaries)
+}
+
+// equalBoundaries checks if both bucket boundaries have identical values
+func equalBoundaries(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // DecrementFromHistogram method reduces the this bucket by the values in another histogram
 func (h *Histogram) DecrementFromHistogram(other *Histogram) {
+	h.cumulativeCounts = nil
 	if len(other.bucketBoundaries) != len(h.bucketBoundaries) {
 		panic("Mismatch in sizes of  bucketBoundaries")
 	}
@@ -176,6 +797,566 @@ func (h *Histogram) DecrementFromHistogram(other *Histogram) {
 	}
 	h.numSamples -= other.numSamples
 	h.total -= other.total
+	h.sumOfSquares -= other.sumOfSquares
+}
+
+// Scale method multiplies all bucket counts and totals by factor.
+// Each scaled bucket count and total is rounded to the nearest int64, and number of
+// samples and total are the sums of the rounded buckets.
+func (h *Histogram) Scale(factor float64) {
+	h.cumulativeCounts = nil
+	h.numSamples = 0
+	h.total = 0
+	for i := range h.bucketCounts {
+		h.bucketCounts[i] = int64(math.Round(float64(h.bucketCounts[i]) * factor))
+		h.bucketTotals[i] = int64(math.Round(float64(h.bucketTotals[i]) * factor))
+		h.numSamples += h.bucketCounts[i]
+		h.total += h.bucketTotals[i]
+	}
+	h.sumOfSquares = int64(math.Round(float64(h.sumOfSquares) * factor))
+}
+
+// WeightedAdd method includes the samples of other histogram scaled by weight into this.
+// Each scaled bucket count and total of other is rounded to the nearest int64 before it is added,
+// so number of samples and total grow by the sums of the rounded buckets.
+// This bucketBoundaries used to construct other histogram must be identical to this.
+func (h *Histogram) WeightedAdd(other *Histogram, weight float64) error {
+	h.cumulativeCounts = nil
+	if !h.sameBoundaries(other) {
+		return mismatchError
+	}
+	for i := range h.bucketCounts {
+		count := int64(math.Round(float64(other.bucketCounts[i]) * weight))
+		total := int64(math.Round(float64(other.bucketTotals[i]) * weight))
+		h.bucketCounts[i] += count
+		h.bucketTotals[i] += total
+		h.numSamples += count
+		h.total += total
+	}
+	h.sumOfSquares += int64(math.Round(float64(other.sumOfSquares) * weight))
+	return nil
+}
+
+// Trim method returns a new histogram where leading and trailing empty buckets are
+// collapsed into the open ended first and last buckets. Number of samples and total are preserved.
+func (h *Histogram) Trim() *Histogram {
+	first, last := -1, -1
+	for i, count := range h.bucketCounts {
+		if count != 0 {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	trimmed := h.Copy()
+	if first == -1 {
+		return trimmed
+	}
+	// New first bucket ends at the low boundary of the first non-empty bucket,
+	// and the new last bucket starts at the high boundary of the last non-empty bucket
+	start := first - 1
+	if start < 0 {
+		start = 0
+	}
+	end := last
+	if end > len(h.bucketBoundaries)-1 {
+		end = len(h.bucketBoundaries) - 1
+	}
+	trimmed.bucketBoundaries = trimmed.bucketBoundaries[start : end+1]
+	trimmed.bucketCounts = make([]int64, len(trimmed.bucketBoundaries)+1)
+	trimmed.bucketTotals = make([]int64, len(trimmed.bucketBoundaries)+1)
+	trimmed.distinctValues = nil
+	if trimmed.bucketLabels != nil {
+		trimmed.bucketLabels = trimmed.bucketLabels[start : end+2]
+	}
+	for i := range h.bucketCounts {
+		// Buckets before start and after end+1 are folded into the open ended buckets
+		j := i - start
+		if j < 0 {
+			j = 0
+		} else if j > len(trimmed.bucketBoundaries) {
+			j = len(trimmed.bucketBoundaries)
+		}
+		trimmed.bucketCounts[j] += h.bucketCounts[i]
+		trimmed.bucketTotals[j] += h.bucketTotals[i]
+	}
+	return trimmed
+}
+
+// AppendBoundary method adds a boundary greater than the last boundary, splitting the
+// open ended last bucket. The last bucket must be empty since its samples cannot be split exactly.
+// A new bucket label is empty.
+func (h *Histogram) AppendBoundary(boundary int64) error {
+	h.cumulativeCounts = nil
+	last := len(h.bucketBoundaries)
+	if boundary <= h.bucketBoundaries[last-1] {
+		return invalidBoundariesError
+	}
+	if h.bucketCounts[last] != 0 || h.bucketTotals[last] != 0 {
+		return nonEmptyBucketError
+	}
+	h.bucketBoundaries = append(h.bucketBoundaries[:last:last], boundary)
+	h.bucketCounts = append(h.bucketCounts[:last+1:last+1], 0)
+	h.bucketTotals = append(h.bucketTotals[:last+1:last+1], 0)
+	h.distinctValues = nil
+	if h.bucketLabels != nil {
+		h.bucketLabels = append(h.bucketLabels[:last+1:last+1], "")
+	}
+	return nil
+}
+
+// PrependBoundary method adds a boundary less than the first boundary, splitting the
+// open ended first bucket. The first bucket must be empty since its samples cannot be split exactly.
+// A new bucket label is empty.
+func (h *Histogram) PrependBoundary(boundary int64) error {
+	h.cumulativeCounts = nil
+	if boundary >= h.bucketBoundaries[0] {
+		return invalidBoundariesError
+	}
+	if h.bucketCounts[0] != 0 || h.bucketTotals[0] != 0 {
+		return nonEmptyBucketError
+	}
+	h.bucketBoundaries = append([]int64{boundary}, h.bucketBoundaries...)
+	h.bucketCounts = append([]int64{0}, h.bucketCounts...)
+	h.bucketTotals = append([]int64{0}, h.bucketTotals...)
+	h.distinctValues = nil
+	if h.bucketLabels != nil {
+		h.bucketLabels = append([]string{""}, h.bucketLabels...)
+	}
+	return nil
+}
+
+// ConvertUnits method returns a new histogram with boundaries and totals divided by divisor,
+// such as 1000 to convert microseconds to milliseconds. Bucket counts are unchanged.
+// Boundaries are rounded down and totals to the nearest integer. An error is returned if
+// divisor is not positive or if rounding makes adjacent boundaries equal.
+func (h *Histogram) ConvertUnits(divisor int64) (*Histogram, error) {
+	if divisor <= 0 {
+		return nil, invalidArgumentError
+	}
+	converted := h.Copy()
+	for i, boundary := range h.bucketBoundaries {
+		converted.bucketBoundaries[i] = floorDiv(boundary, divisor)
+	}
+	if err := validateBoundaries(converted.bucketBoundaries); err != nil {
+		return nil, err
+	}
+	d := float64(divisor)
+	// The total is the sum of the rounded bucket totals to stay consistent with them
+	converted.total = 0
+	for i := range converted.bucketTotals {
+		converted.bucketTotals[i] = int64(math.Round(float64(h.bucketTotals[i]) / d))
+		converted.total += converted.bucketTotals[i]
+	}
+	converted.sumOfSquares = int64(math.Round(float64(h.sumOfSquares) / d / d))
+	for i, value := range h.reservoir {
+		converted.reservoir[i] = floorDiv(value, divisor)
+	}
+	// Rounding down keeps the order of the values, so the heap stays valid
+	for i, value := range h.topValues {
+		converted.topValues[i] = floorDiv(value, divisor)
+	}
+	converted.mapDistinct(func(value int64) int64 {
+		return floorDiv(value, divisor)
+	})
+	return converted, nil
+}
+
+// floorDiv returns a divided by positive b rounded down
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// SplitBucket method adds a boundary at inside a finite bucket, splitting it in two.
+// The count and total of the bucket are divided in proportion to the widths of the two
+// new buckets, rounded to the nearest int64. Both new buckets keep the label of the bucket.
+func (h *Histogram) SplitBucket(index int, at int64) error {
+	h.cumulativeCounts = nil
+	if index <= 0 || index >= len(h.bucketBoundaries) {
+		return indexOutOfBoundError
+	}
+	low, high := h.BucketRanges(index)
+	if at <= low || at >= high {
+		return invalidBoundariesError
+	}
+	fraction := float64(at-low) / float64(high-low)
+	lowCount := int64(math.Round(float64(h.bucketCounts[index]) * fraction))
+	lowTotal := int64(math.Round(float64(h.bucketTotals[index]) * fraction))
+	h.bucketBoundaries = insertInt64(h.bucketBoundaries, index, at)
+	h.bucketCounts = insertInt64(h.bucketCounts, index, lowCount)
+	h.bucketTotals = insertInt64(h.bucketTotals, index, lowTotal)
+	h.bucketCounts[index+1] -= lowCount
+	h.bucketTotals[index+1] -= lowTotal
+	// The distinct values of the split bucket cannot be told apart
+	h.distinctValues = nil
+	if h.bucketLabels != nil {
+		labels := make([]string, 0, len(h.bucketLabels)+1)
+		labels = append(labels, h.bucketLabels[:index+1]...)
+		h.bucketLabels = append(labels, h.bucketLabels[index:]...)
+	}
+	return nil
+}
+
+// MergeBucket method merges bucket index with bucket index+1 by removing the boundary between them.
+// Counts and totals are summed exactly and the merged bucket keeps the label of bucket index.
+// The last remaining boundary cannot be removed.
+func (h *Histogram) MergeBucket(index int) error {
+	h.cumulativeCounts = nil
+	if index < 0 || index >= len(h.bucketBoundaries) {
+		return indexOutOfBoundError
+	}
+	if len(h.bucketBoundaries) == 1 {
+		return emptyError
+	}
+	count := h.bucketCounts[index] + h.bucketCounts[index+1]
+	total := h.bucketTotals[index] + h.bucketTotals[index+1]
+	h.bucketBoundaries = removeInt64(h.bucketBoundaries, index)
+	h.bucketCounts = removeInt64(h.bucketCounts, index+1)
+	h.bucketTotals = removeInt64(h.bucketTotals, index+1)
+	h.bucketCounts[index] = count
+	h.bucketTotals[index] = total
+	h.distinctValues = nil
+	if h.bucketLabels != nil {
+		labels := make([]string, 0, len(h.bucketLabels)-1)
+		labels = append(labels, h.bucketLabels[:index+1]...)
+		h.bucketLabels = append(labels, h.bucketLabels[index+2:]...)
+	}
+	return nil
+}
+
+// CompressTo method returns a histogram with at most maxBuckets buckets, merging adjacent buckets
+// with MergeBucket one pair at a time. Each step merges the pair which least distorts the estimated
+// cumulative distribution, so boundaries between sparse buckets are removed first while dense regions
+// keep their resolution and quantile accuracy. Merging a pair of finite buckets costs the error of the
+// interpolated cumulative count at the removed boundary, while merging into an open ended bucket
+// costs the count of both buckets. The receiver itself is returned if it already fits, otherwise
+// it is left unchanged. maxBuckets must be at least 2.
+func (h *Histogram) CompressTo(maxBuckets int) (*Histogram, error) {
+	if maxBuckets < 2 {
+		return nil, invalidArgumentError
+	}
+	if len(h.bucketCounts) <= maxBuckets {
+		return h, nil
+	}
+	compressed := h.Copy()
+	for len(compressed.bucketCounts) > maxBuckets {
+		best, bestCost := 0, math.Inf(1)
+		for i := range compressed.bucketBoundaries {
+			if cost := compressed.mergeCost(i); cost < bestCost {
+				best, bestCost = i, cost
+			}
+		}
+		compressed.MergeBucket(best)
+	}
+	return compressed, nil
+}
+
+// mergeCost method returns the distortion of the cumulative distribution caused by merging
+// bucket index with bucket index+1
+func (h *Histogram) mergeCost(index int) float64 {
+	count, nextCount := float64(h.bucketCounts[index]), float64(h.bucketCounts[index+1])
+	if index == 0 || index == len(h.bucketBoundaries)-1 {
+		return math.Abs(count) + math.Abs(nextCount)
+	}
+	low, mid := h.BucketRanges(index)
+	_, high := h.BucketRanges(index + 1)
+	width, nextWidth := float64(mid-low), float64(high-mid)
+	return math.Abs(count*nextWidth-nextCount*width) / (width + nextWidth)
+}
+
+// removeInt64 returns a new slice without the value at index
+func removeInt64(values []int64, index int) []int64 {
+	removed := make([]int64, 0, len(values)-1)
+	removed = append(removed, values[:index]...)
+	return append(removed, values[index+1:]...)
+}
+
+// insertInt64 returns a new slice with value inserted at index
+func insertInt64(values []int64, index int, value int64) []int64 {
+	inserted := make([]int64, 0, len(values)+1)
+	inserted = append(inserted, values[:index]...)
+	inserted = append(inserted, value)
+	return append(inserted, values[index:]...)
+}
+
+// Shift method returns a new histogram with every sample shifted by delta.
+// Bucket boundaries are shifted by delta, so every sample stays in the same bucket,
+// and bucket totals grow by delta for every sample in the bucket.
+// An error is returned if a shifted boundary overflows int64.
+func (h *Histogram) Shift(delta int64) (*Histogram, error) {
+	for _, boundary := range h.bucketBoundaries {
+		if (delta > 0 && boundary > math.MaxInt64-delta) || (delta < 0 && boundary < math.MinInt64-delta) {
+			return nil, overflowError
+		}
+	}
+	shifted := h.Copy()
+	for i := range shifted.bucketBoundaries {
+		shifted.bucketBoundaries[i] += delta
+	}
+	for i := range shifted.bucketCounts {
+		shifted.bucketTotals[i] += shifted.bucketCounts[i] * delta
+	}
+	// Sum of (x + delta)^2 adds 2 * delta * total + numSamples * delta^2
+	shifted.sumOfSquares += 2*delta*h.total + h.numSamples*delta*delta
+	shifted.total += shifted.numSamples * delta
+	for i := range shifted.reservoir {
+		shifted.reservoir[i] += delta
+	}
+	for i := range shifted.topValues {
+		shifted.topValues[i] += delta
+	}
+	shifted.mapDistinct(func(value int64) int64 {
+		return value + delta
+	})
+	return shifted, nil
+}
+
+// Grow method returns a new histogram with newBoundaries, which must be a superset of the
+// bucket boundaries. Samples of each bucket are moved into the new bucket with the same range.
+// Buckets split by the added boundaries must be empty, since their samples cannot be split exactly.
+// Labels of split buckets are dropped.
+func (h *Histogram) Grow(newBoundaries []int64) (*Histogram, error) {
+	if err := validateBoundaries(newBoundaries); err != nil {
+		return nil, err
+	}
+	// positions[i] is the index of bucketBoundaries[i] within newBoundaries
+	positions := make([]int, 0, len(h.bucketBoundaries)+2)
+	positions = append(positions, -1)
+	j := 0
+	for _, boundary := range h.bucketBoundaries {
+		for j < len(newBoundaries) && newBoundaries[j] < boundary {
+			j++
+		}
+		if j == len(newBoundaries) || newBoundaries[j] != boundary {
+			return nil, invalidBoundariesError
+		}
+		positions = append(positions, j)
+	}
+	positions = append(positions, len(newBoundaries))
+	grown := h.Copy()
+	grown.bucketBoundaries = make([]int64, len(newBoundaries))
+	copy(grown.bucketBoundaries, newBoundaries)
+	grown.bucketCounts = make([]int64, len(newBoundaries)+1)
+	grown.bucketTotals = make([]int64, len(newBoundaries)+1)
+	grown.distinctValues = nil
+	if h.bucketLabels != nil {
+		grown.bucketLabels = make([]string, len(newBoundaries)+1)
+	}
+	for i := range h.bucketCounts {
+		// Bucket i covers the new buckets after positions[i] up to positions[i+1]
+		target := positions[i] + 1
+		if positions[i+1] != target {
+			if h.bucketCounts[i] != 0 || h.bucketTotals[i] != 0 {
+				return nil, nonEmptyBucketError
+			}
+			continue
+		}
+		grown.bucketCounts[target] = h.bucketCounts[i]
+		grown.bucketTotals[target] = h.bucketTotals[i]
+		if h.bucketLabels != nil {
+			grown.bucketLabels[target] = h.bucketLabels[i]
+		}
+	}
+	return grown, nil
+}
+
+// Compact method reallocates the internal slices to exactly their length,
+// releasing any spare capacity retained by the histogram
+func (h *Histogram) Compact() {
+	h.cumulativeCounts = nil
+	compacted := h.Copy()
+	h.bucketBoundaries = compacted.bucketBoundaries
+	h.bucketCounts = compacted.bucketCounts
+	h.bucketTotals = compacted.bucketTotals
+	h.bucketLabels = compacted.bucketLabels
+}
+
+// Repair method fixes a possibly corrupted histogram and returns a description of each correction.
+// Bucket counts and totals are resized to match the bucket boundaries, negative bucket counts
+// are clamped to zero, and number of samples and total are recomputed from the buckets.
+// Bucket boundaries are not repaired.
+func (h *Histogram) Repair() []string {
+	h.cumulativeCounts = nil
+	var corrections []string
+	size := len(h.bucketBoundaries) + 1
+	if len(h.bucketCounts) != size {
+		corrections = append(corrections, fmt.Sprintf("resized bucket counts from %d to %d", len(h.bucketCounts), size))
+		bucketCounts := make([]int64, size)
+		copy(bucketCounts, h.bucketCounts)
+		h.bucketCounts = bucketCounts
+	}
+	if len(h.bucketTotals) != size {
+		corrections = append(corrections, fmt.Sprintf("resized bucket totals from %d to %d", len(h.bucketTotals), size))
+		bucketTotals := make([]int64, size)
+		copy(bucketTotals, h.bucketTotals)
+		h.bucketTotals = bucketTotals
+	}
+	var numSamples, total int64
+	for i := range h.bucketCounts {
+		if h.bucketCounts[i] < 0 {
+			corrections = append(corrections, fmt.Sprintf("clamped count %d of bucket %d to 0", h.bucketCounts[i], i))
+			h.bucketCounts[i] = 0
+		}
+		numSamples += h.bucketCounts[i]
+		total += h.bucketTotals[i]
+	}
+	if h.numSamples != numSamples {
+		corrections = append(corrections, fmt.Sprintf("recomputed number of samples from %d to %d", h.numSamples, numSamples))
+		h.numSamples = numSamples
+	}
+	if h.total != total {
+		corrections = append(corrections, fmt.Sprintf("recomputed total from %d to %d", h.total, total))
+		h.total = total
+	}
+	return corrections
+}
+
+// CheckInvariants method validates the state of the histogram, which may be broken by direct edits,
+// and returns an error joining all the violations found or nil if there are none.
+// Bucket boundaries must be non-empty and strictly increasing, there must be one more bucket count
+// and bucket total than boundaries, and number of samples and total must be the sums of the bucket
+// counts and totals. Negative bucket counts are also violations if nonNegative is set.
+// Each violation wraps one of the errors returned by the decoders, so errors.Is can test for them.
+func (h *Histogram) CheckInvariants(nonNegative bool) error {
+	var violations []error
+	if len(h.bucketBoundaries) == 0 {
+		violations = append(violations, emptyError)
+	}
+	for i := 0; i < len(h.bucketBoundaries)-1; i++ {
+		if h.bucketBoundaries[i] >= h.bucketBoundaries[i+1] {
+			violations = append(violations, fmt.Errorf("%w: boundary %d is %d but boundary %d is %d",
+				invalidBoundariesError, i, h.bucketBoundaries[i], i+1, h.bucketBoundaries[i+1]))
+		}
+	}
+	size := len(h.bucketBoundaries) + 1
+	if len(h.bucketCounts) != size {
+		violations = append(violations, fmt.Errorf("%w: %d bucket counts for %d buckets", invalidLengthsError, len(h.bucketCounts), size))
+	}
+	if len(h.bucketTotals) != size {
+		violations = append(violations, fmt.Errorf("%w: %d bucket totals for %d buckets", invalidLengthsError, len(h.bucketTotals), size))
+	}
+	var numSamples, total int64
+	for i, count := range h.bucketCounts {
+		if nonNegative && count < 0 {
+			violations = append(violations, fmt.Errorf("%w: bucket %d has count %d", negativeCountError, i, count))
+		}
+		numSamples += count
+	}
+	for _, bucketTotal := range h.bucketTotals {
+		total += bucketTotal
+	}
+	if numSamples != h.numSamples {
+		violations = append(violations, fmt.Errorf("%w: number of samples is %d but bucket counts add up to %d", inconsistentSumError, h.numSamples, numSamples))
+	}
+	if total != h.total {
+		violations = append(violations, fmt.Errorf("%w: total is %d but bucket totals add up to %d", inconsistentSumError, h.total, total))
+	}
+	return errors.Join(violations...)
+}
+
+// Equal method returns true if other histogram has identical bucket boundaries, bucket counts,
+// bucket totals, number of samples and total, and both use the same WithUpperClosed option
+func (h *Histogram) Equal(other *Histogram) bool {
+	if !h.sameBoundaries(other) || h.numSamples != other.numSamples || h.total != other.total {
+		return false
+	}
+	for i := range h.bucketCounts {
+		if h.bucketCounts[i] != other.bucketCounts[i] || h.bucketTotals[i] != other.bucketTotals[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ApproxEqual method returns true if other histogram has identical bucket boundaries and
+// every bucket count and total differs by at most tolerance
+func (h *Histogram) ApproxEqual(other *Histogram, tolerance int64) bool {
+	if !h.sameBoundaries(other) {
+		return false
+	}
+	within := func(a, b int64) bool {
+		return a-b <= tolerance && b-a <= tolerance
+	}
+	for i := range h.bucketCounts {
+		if !within(h.bucketCounts[i], other.bucketCounts[i]) || !within(h.bucketTotals[i], other.bucketTotals[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fingerprint method returns a FNV-1a hash of the state compared by Equal.
+// Equal histograms have the same fingerprint.
+func (h *Histogram) Fingerprint() uint64 {
+	hash := fnv.New64a()
+	var buf [8]byte
+	write := func(values ...int64) {
+		for _, value := range values {
+			binary.LittleEndian.PutUint64(buf[:], uint64(value))
+			hash.Write(buf[:])
+		}
+	}
+	// Length prefix keeps boundaries distinct from the counts that follow
+	write(int64(len(h.bucketBoundaries)))
+	write(h.bucketBoundaries...)
+	write(h.bucketCounts...)
+	write(h.bucketTotals...)
+	write(h.numSamples, h.total)
+	return hash.Sum64()
+}
+
+// Signature method returns a sketch of the distribution of samples, which unlike Fingerprint
+// is similar for similar distributions. The bits are split evenly among the bucket boundaries
+// and each group holds the fraction of samples below its boundary as a unary code, the first
+// round(fraction * size) bits of the group are set. The Hamming distance between signatures of
+// histograms with identical boundaries is thus about bits / len(bucketBoundaries) times the sum
+// of differences between their cumulative fractions, so it is zero for identical distributions
+// and grows as they move apart. Use at least 8 bits per bucket boundary to distinguish fractions
+// differing by about an eighth. The result holds (bits + 7) / 8 bytes with the bits in order
+// from the least significant bit of the first byte, it is all zeros for an empty histogram.
+func (h *Histogram) Signature(bits int) []byte {
+	if bits < 0 {
+		bits = 0
+	}
+	signature := make([]byte, (bits+7)/8)
+	if h.numSamples <= 0 {
+		return signature
+	}
+	var cumulative int64
+	for i := range h.bucketBoundaries {
+		cumulative += h.bucketCounts[i]
+		start := i * bits / len(h.bucketBoundaries)
+		end := (i + 1) * bits / len(h.bucketBoundaries)
+		fraction := math.Max(0, math.Min(1, float64(cumulative)/float64(h.numSamples)))
+		set := int(math.Round(fraction * float64(end-start)))
+		for bit := start; bit < start+set; bit++ {
+			signature[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return signature
+}
+
+// SafeDecrementFromHistogram method is like DecrementFromHistogram but returns an error without
+// changing this histogram if the bucket boundaries differ or any bucket count would become negative
+func (h *Histogram) SafeDecrementFromHistogram(other *Histogram) error {
+	if !h.sameBoundaries(other) {
+		return mismatchError
+	}
+	for i := range h.bucketCounts {
+		if h.bucketCounts[i] < other.bucketCounts[i] {
+			return negativeCountError
+		}
+	}
+	if h.numSamples < other.numSamples {
+		return negativeCountError
+	}
+	h.DecrementFromHistogram(other)
+	return nil
 }
 
 // Copy method makes a deep copy of the histogram
@@ -186,17 +1367,132 @@ func (h *Histogram) Copy() *Histogram {
 	copy(bucketCounts, h.bucketCounts)
 	bucketTotals := make([]int64, len(h.bucketTotals))
 	copy(bucketTotals, h.bucketTotals)
+	var bucketLabels []string
+	if h.bucketLabels != nil {
+		bucketLabels = make([]string, len(h.bucketLabels))
+		copy(bucketLabels, h.bucketLabels)
+	}
+	var reservoir []int64
+	if h.reservoir != nil {
+		reservoir = make([]int64, len(h.reservoir), h.reservoirSize)
+		copy(reservoir, h.reservoir)
+	}
+	var topValues minHeap
+	if h.topValues != nil {
+		topValues = make(minHeap, len(h.topValues), h.topK)
+		copy(topValues, h.topValues)
+	}
+	return &Histogram{
+		bucketBoundaries:  bucketBoundaries,
+		bucketCounts:      bucketCounts,
+		bucketTotals:      bucketTotals,
+		numSamples:        h.numSamples,
+		total:             h.total,
+		sumOfSquares:      h.sumOfSquares,
+		bucketLabels:      bucketLabels,
+		reservoirSize:     h.reservoirSize,
+		reservoir:         reservoir,
+		topK:              h.topK,
+		topValues:         topValues,
+		clampValues:       h.clampValues,
+		upperClosed:       h.upperClosed,
+		rejected:          h.rejected,
+		distinctCount:     h.distinctCount,
+		distinctValues:    h.copyDistinct(),
+		cumulativeEnabled: h.cumulativeEnabled,
+	}
+}
+
+// atomicCopy method makes a deep copy of the buckets and aggregates of the histogram loading them
+// atomically, so it may be called while other goroutines call AtomicIncrement. The copy keeps the
+// bucket boundaries, labels and options but not the samples retained by Increment, such as the
+// reservoir, top values and distinct values, which are not written atomically.
+func (h *Histogram) atomicCopy() *Histogram {
+	bucketBoundaries := make([]int64, len(h.bucketBoundaries))
+	copy(bucketBoundaries, h.bucketBoundaries)
+	var bucketLabels []string
+	if h.bucketLabels != nil {
+		bucketLabels = make([]string, len(h.bucketLabels))
+		copy(bucketLabels, h.bucketLabels)
+	}
 	return &Histogram{
 		bucketBoundaries: bucketBoundaries,
-		bucketCounts:     bucketCounts,
-		bucketTotals:     bucketTotals,
-		numSamples:       h.numSamples,
-		total:            h.total,
+		bucketCounts:     atomicLoadAll(h.bucketCounts),
+		bucketTotals:     atomicLoadAll(h.bucketTotals),
+		numSamples:       atomic.LoadInt64(&h.numSamples),
+		total:            atomic.LoadInt64(&h.total),
+		sumOfSquares:     atomic.LoadInt64(&h.sumOfSquares),
+		bucketLabels:     bucketLabels,
+		clampValues:      h.clampValues,
+		upperClosed:      h.upperClosed,
 	}
 }
+
+// BucketBoundaries method returns the bucket boundaries of the histogram.
+// Note: The returned slice is shared with the histogram, modifying it corrupts the
+// histogram. Use BucketBoundariesCopy if the slice may be modified or reused.
 func (h *Histogram) BucketBoundaries() []int64 {
 	return h.bucketBoundaries
 }
+
+// NormalizedBoundaries method returns the position of each bucket boundary within
+// [bucketBoundaries[0], bucketBoundaries[last]] as a fraction in [0, 1].
+// It is empty if there is only one bucket boundary.
+func (h *Histogram) NormalizedBoundaries() []float64 {
+	normalized := []float64{}
+	if len(h.bucketBoundaries) < 2 {
+		return normalized
+	}
+	first := h.bucketBoundaries[0]
+	width := float64(h.bucketBoundaries[len(h.bucketBoundaries)-1] - first)
+	for _, boundary := range h.bucketBoundaries {
+		normalized = append(normalized, float64(boundary-first)/width)
+	}
+	return normalized
+}
+
+// BucketBoundariesCopy method returns a copy of the bucket boundaries of the histogram
+func (h *Histogram) BucketBoundariesCopy() []int64 {
+	bucketBoundaries := make([]int64, len(h.bucketBoundaries))
+	copy(bucketBoundaries, h.bucketBoundaries)
+	return bucketBoundaries
+}
+
+// BucketCounts method returns the bucket counts of the histogram.
+// Note: The returned slice is shared with the histogram and is not safe to read while
+// other goroutines call AtomicIncrement. Use BucketCountsSnapshot in that case.
 func (h *Histogram) BucketCounts() []int64 {
 	return h.bucketCounts
 }
+
+// Columns method returns copies of the bucket boundaries, bucket counts and bucket totals.
+// Bucket counts and totals have one more element than boundaries, element i of them
+// belongs to the bucket ending at boundaries[i], and the last to the bucket after the last boundary.
+func (h *Histogram) Columns() (boundaries, counts, totals []int64) {
+	boundaries = make([]int64, len(h.bucketBoundaries))
+	copy(boundaries, h.bucketBoundaries)
+	counts = make([]int64, len(h.bucketCounts))
+	copy(counts, h.bucketCounts)
+	totals = make([]int64, len(h.bucketTotals))
+	copy(totals, h.bucketTotals)
+	return boundaries, counts, totals
+}
+
+// BucketCountsSnapshot method returns a copy of the bucket counts loaded atomically
+func (h *Histogram) BucketCountsSnapshot() []int64 {
+	return atomicLoadAll(h.bucketCounts)
+}
+
+// BucketTotalsSnapshot method returns a copy of the bucket totals loaded atomically
+func (h *Histogram) BucketTotalsSnapshot() []int64 {
+	return atomicLoadAll(h.bucketTotals)
+}
+
+// atomicLoadAll returns a copy of values loaded atomically
+func atomicLoadAll(values []int64) []int64 {
+	loaded := make([]int64, len(values))
+	for i := range values {
+		loaded[i] = atomic.LoadInt64(&values[i])
+	}
+	return loaded
+}
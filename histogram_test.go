@@ -1,9 +1,20 @@
 package histogram
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestHistogram(t *testing.T) {
@@ -56,3 +67,2352 @@ func TestRange(t *testing.T) {
 		t.Error("Range(10, 1, -3) Expected", []int64{10, 7, 4, 1}, "Got", Range(10, 1, -3))
 	}
 }
+
+func TestMarshalText(t *testing.T) {
+	h, _ := New([]int64{1, 2, 3})
+	h.Increment(1)
+	h.Increment(2)
+	h.Increment(2)
+	h.Increment(5)
+	text, err := h.MarshalText()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected := "boundaries=1,2,3;counts=0,1,2,1;totals=0,1,4,5"
+	if string(text) != expected {
+		t.Error("Expected", expected, "Got", string(text))
+	}
+	var other Histogram
+	if err := other.UnmarshalText(text); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !h.Equal(&other) {
+		t.Error("Expected", h, "Got", &other)
+	}
+	for _, invalid := range []string{
+		"boundaries=3,2,1;counts=0,0,0,0;totals=0,0,0,0",
+		"boundaries=1,2,3;counts=0,0,0;totals=0,0,0,0",
+		"boundaries=;counts=0;totals=0",
+		"boundaries=1,a;counts=0,0,0;totals=0,0,0",
+		"counts=0,0;totals=0,0",
+	} {
+		if err := other.UnmarshalText([]byte(invalid)); err == nil {
+			t.Error("Expected error for", invalid)
+		}
+	}
+}
+
+func TestAtomicIncrementFromHistogram(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local, _ := New([]int64{10, 20})
+			local.Increment(5)
+			local.Increment(15)
+			local.Increment(25)
+			h.AtomicIncrementFromHistogram(local)
+		}()
+	}
+	wg.Wait()
+	if h.Count() != 24 || h.Total() != 360 || h.BucketCount(1) != 8 {
+		t.Error("Unexpected count", h.Count(), "or total", h.Total())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic")
+		}
+	}()
+	other, _ := New([]int64{10, 30})
+	h.AtomicIncrementFromHistogram(other)
+}
+
+func TestFloatHistogram(t *testing.T) {
+	if _, err := NewFloatBoundaries([]float64{0.5, 0.25}); err == nil {
+		t.Error("Expected error")
+	}
+	h, err := NewFloatBoundaries([]float64{0.1, 0.5, 1.5})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	h.Increment(0.05)
+	h.Increment(0.1)
+	h.Increment(0.25)
+	h.Increment(2)
+	if h.BucketCount(0) != 1 ||
+		h.BucketCount(1) != 2 ||
+		h.BucketCount(2) != 0 ||
+		h.BucketCount(3) != 1 {
+		t.Error("Unexpected count")
+	}
+	if h.Count() != 4 || h.BucketTotal(1) != 0.35 || h.Average() != 2.4/4 {
+		t.Error("Unexpected count", h.Count(), "or total", h.Total())
+	}
+	if low, _ := h.BucketRanges(0); !math.IsInf(low, -1) {
+		t.Error("Expected -Inf Got", low)
+	}
+	boundaries := []float64{0.1, 0.5}
+	h, _ = NewFloatBoundaries(boundaries)
+	boundaries[0] = 0.3
+	if _, high := h.BucketRanges(0); high != 0.1 {
+		t.Error("Expected 0.1 Got", high)
+	}
+}
+
+func TestDrainTo(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	dest, _ := New([]int64{10, 20})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := int64(0); j < 1000; j++ {
+				h.AtomicIncrement(j % 30)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := h.DrainTo(dest); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	wg.Wait()
+	h.DrainTo(dest)
+	if dest.Count() != 4000 || h.Count() != 0 || h.BucketCount(0) != 0 {
+		t.Error("Expected 4000 samples drained Got", dest.Count(), "remaining", h.Count())
+	}
+	other, _ := New([]int64{10})
+	if err := h.DrainTo(other); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	h, _ := New([]int64{1, 2})
+	h.Increment(0)
+	h.Increment(1)
+	h.Increment(1)
+	h.Increment(5)
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected := `{"boundaries":[1,2],"counts":[1,2,1],"totals":[0,2,5]}`
+	if string(data) != expected {
+		t.Error("Expected", expected, "Got", string(data))
+	}
+	var other Histogram
+	if err := json.Unmarshal(data, &other); err != nil || !h.Equal(&other) {
+		t.Error("Expected", h, "Got", &other, err)
+	}
+	data, err = json.Marshal(CumulativeJSON{h})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected = `{"buckets":[{"le":"1","count":1,"total":0},{"le":"2","count":3,"total":2},{"le":"+Inf","count":4,"total":7}]}`
+	if string(data) != expected {
+		t.Error("Expected", expected, "Got", string(data))
+	}
+	var cumulative CumulativeJSON
+	if err := json.Unmarshal(data, &cumulative); err != nil || !h.Equal(cumulative.Histogram) {
+		t.Error("Expected", h, "Got", cumulative.Histogram, err)
+	}
+	if err := json.Unmarshal([]byte(`{"buckets":[{"le":"1","count":1}]}`), &cumulative); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestWeightedAdd(t *testing.T) {
+	h, _ := New([]int64{10})
+	recent, _ := New([]int64{10})
+	for i := 0; i < 4; i++ {
+		h.Increment(1)
+		recent.Increment(20)
+	}
+	h.Scale(0.75)
+	if err := h.WeightedAdd(recent, 0.25); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{3, 1}, h.BucketCounts()) || h.Count() != 4 || h.Total() != 23 {
+		t.Error("Unexpected counts", h.BucketCounts(), "or total", h.Total())
+	}
+	other, _ := New([]int64{20})
+	if err := h.WeightedAdd(other, 1); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	h, _ := New([]int64{10})
+	if !h.IsEmpty() {
+		t.Error("Expected empty")
+	}
+	h.Increment(1)
+	if h.IsEmpty() {
+		t.Error("Expected not empty")
+	}
+	other, _ := New([]int64{10})
+	other.Increment(1)
+	other.Increment(2)
+	h.DecrementFromHistogram(other)
+	if !h.IsEmpty() || h.Average() != 0 {
+		t.Error("Expected empty after negative count", h.Count())
+	}
+}
+
+func TestBucketBoundariesCopy(t *testing.T) {
+	h, _ := New([]int64{1, 2, 3})
+	boundaries := h.BucketBoundariesCopy()
+	boundaries[0] = 5
+	if !reflect.DeepEqual([]int64{1, 2, 3}, h.BucketBoundaries()) {
+		t.Error("Expected boundaries to be unchanged Got", h.BucketBoundaries())
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	if _, err := h.Quantile(0.5); err == nil {
+		t.Error("Expected error")
+	}
+	for i := int64(0); i < 20; i++ {
+		h.Increment(i)
+	}
+	for _, c := range []struct {
+		q        float64
+		expected int64
+	}{{0, 0}, {0.25, 5}, {0.5, 10}, {0.75, 15}, {1, 20}} {
+		if value, err := h.Quantile(c.q); err != nil || value != c.expected {
+			t.Error("Quantile", c.q, "Expected", c.expected, "Got", value, err)
+		}
+	}
+	if _, err := h.Quantile(1.5); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	h, _ := New([]int64{1, 2})
+	h.Increment(0)
+	h.Increment(1)
+	h.Increment(1)
+	h.Increment(5)
+	if s := fmt.Sprintf("%v", h); s != "count=4 mean=1.75 p50=2 p99=2" {
+		t.Error("Unexpected summary", s)
+	}
+	expected := "[-inf, 1) count=1 total=0 average=0\n" +
+		"[1, 2) count=2 total=2 average=1\n" +
+		"[2, +inf) count=1 total=5 average=5"
+	if s := fmt.Sprintf("%+v", h); s != expected {
+		t.Error("Expected", expected, "Got", s)
+	}
+	expected = "&histogram.Histogram{bucketBoundaries:[]int64{1, 2}, bucketCounts:[]int64{1, 2, 1}, " +
+		"bucketTotals:[]int64{0, 2, 5}, numSamples:4, total:7}"
+	if s := fmt.Sprintf("%#v", h); s != expected {
+		t.Error("Expected", expected, "Got", s)
+	}
+}
+
+func TestCountAboveBelow(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	for i := int64(-5); i < 25; i++ {
+		h.Increment(i)
+	}
+	for _, c := range []struct {
+		threshold    int64
+		below, above int64
+	}{{-10, 0, 30}, {0, 5, 24}, {5, 10, 19}, {10, 15, 14}, {19, 24, 5}, {30, 30, 0}} {
+		if below := h.CountBelow(c.threshold); below != c.below {
+			t.Error("CountBelow", c.threshold, "Expected", c.below, "Got", below)
+		}
+		if above := h.CountAbove(c.threshold); above != c.above {
+			t.Error("CountAbove", c.threshold, "Expected", c.above, "Got", above)
+		}
+	}
+	if count := h.CountInRange(0, 10); count != 10 {
+		t.Error("CountInRange Expected 10 Got", count)
+	}
+}
+
+func TestNewSorted(t *testing.T) {
+	boundaries := []int64{10, 24, 1, 4}
+	h, err := NewSorted(boundaries)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{1, 4, 10, 24}, h.BucketBoundaries()) {
+		t.Error("Expected sorted boundaries Got", h.BucketBoundaries())
+	}
+	if !reflect.DeepEqual([]int64{10, 24, 1, 4}, boundaries) {
+		t.Error("Expected input to be unchanged Got", boundaries)
+	}
+	if _, err := NewSorted([]int64{3, 1, 3}); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestMaxTotalBucket(t *testing.T) {
+	h, _ := New([]int64{10, 100})
+	if _, ok := h.MaxTotalBucket(); ok {
+		t.Error("Expected not ok")
+	}
+	for i := 0; i < 5; i++ {
+		h.Increment(1)
+	}
+	h.Increment(50)
+	if index, ok := h.MaxTotalBucket(); !ok || index != 1 {
+		t.Error("Expected 1 Got", index, ok)
+	}
+}
+
+func TestUnderflowOverflow(t *testing.T) {
+	h, _ := New([]int64{0, 10})
+	h.Increment(-3)
+	h.Increment(-2)
+	h.Increment(5)
+	h.Increment(10)
+	if h.UnderflowCount() != 2 || h.UnderflowTotal() != -5 {
+		t.Error("Unexpected underflow", h.UnderflowCount(), h.UnderflowTotal())
+	}
+	if h.OverflowCount() != 1 || h.OverflowTotal() != 10 {
+		t.Error("Unexpected overflow", h.OverflowCount(), h.OverflowTotal())
+	}
+}
+
+func TestEqualFingerprint(t *testing.T) {
+	h, _ := New([]int64{1, 2})
+	h.Increment(1)
+	other := h.Copy()
+	if !h.Equal(other) || h.Fingerprint() != other.Fingerprint() {
+		t.Error("Expected equal histograms with equal fingerprints")
+	}
+	other.Increment(5)
+	if h.Equal(other) || h.Fingerprint() == other.Fingerprint() {
+		t.Error("Expected different histograms with different fingerprints")
+	}
+	different, _ := New([]int64{1, 3})
+	different.Increment(1)
+	if h.Equal(different) || h.Fingerprint() == different.Fingerprint() {
+		t.Error("Expected different boundaries to differ")
+	}
+}
+
+func TestQuantileOf(t *testing.T) {
+	a, _ := New([]int64{0, 10, 20})
+	b, _ := New([]int64{0, 10, 20})
+	for i := int64(0); i < 10; i++ {
+		a.Increment(i)
+		b.Increment(i + 10)
+	}
+	if value, err := QuantileOf(0.5, a, b); err != nil || value != 10 {
+		t.Error("Expected 10 Got", value, err)
+	}
+	if value, err := QuantileOf(0.75, a, b); err != nil || value != 15 {
+		t.Error("Expected 15 Got", value, err)
+	}
+	c, _ := New([]int64{0, 10})
+	if _, err := QuantileOf(0.5, a, c); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err := QuantileOf(0.5); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	h, _ := New([]int64{1, 2, 3, 4, 5, 6})
+	h.Increment(3)
+	h.Increment(4)
+	trimmed := h.Trim()
+	if !reflect.DeepEqual([]int64{3, 4, 5}, trimmed.BucketBoundaries()) ||
+		!reflect.DeepEqual([]int64{0, 1, 1, 0}, trimmed.BucketCounts()) {
+		t.Error("Unexpected trim", trimmed.BucketBoundaries(), trimmed.BucketCounts())
+	}
+	if trimmed.Count() != h.Count() || trimmed.Total() != h.Total() {
+		t.Error("Expected count and total to be preserved")
+	}
+	h.Increment(0)
+	h.Increment(10)
+	if trimmed := h.Trim(); !trimmed.Equal(h) {
+		t.Error("Expected no trim Got", trimmed.BucketBoundaries())
+	}
+}
+
+func TestLabels(t *testing.T) {
+	h, _ := New([]int64{100, 500})
+	if h.BucketLabel(0) != "" {
+		t.Error("Expected no label")
+	}
+	if err := h.SetLabels([]string{"fast", "acceptable"}); err == nil {
+		t.Error("Expected error")
+	}
+	if err := h.SetLabels([]string{"fast", "acceptable", "slow"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	h.Increment(200)
+	h.Clear()
+	c := h.Copy()
+	if h.BucketLabel(2) != "slow" || c.BucketLabel(1) != "acceptable" {
+		t.Error("Expected labels to be kept")
+	}
+}
+
+func TestQuantileError(t *testing.T) {
+	h, _ := New([]int64{0, 10, 100})
+	if h.QuantileError(0.5) != 0 {
+		t.Error("Expected 0 for empty histogram")
+	}
+	h.Increment(5)
+	h.Increment(50)
+	h.Increment(500)
+	if e := h.QuantileError(0.5); e != 90 {
+		t.Error("Expected 90 Got", e)
+	}
+	if e := h.QuantileError(0.1); e != 10 {
+		t.Error("Expected 10 Got", e)
+	}
+	if e := h.QuantileError(1); e != math.MaxInt64 {
+		t.Error("Expected MaxInt64 Got", e)
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	dest, _ := New([]int64{10})
+	h, _ := New([]int64{10})
+	h.Increment(1)
+	h.Increment(11)
+	for i := 0; i < 3; i++ {
+		if err := h.MergeInto(dest); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	if !reflect.DeepEqual([]int64{3, 3}, dest.BucketCounts()) || dest.Total() != 36 {
+		t.Error("Unexpected counts", dest.BucketCounts(), "or total", dest.Total())
+	}
+	other, _ := New([]int64{11})
+	if err := h.MergeInto(other); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	boundaries := make([]int64, 2, 16)
+	boundaries[0], boundaries[1] = 1, 2
+	h, _ := New(boundaries)
+	h.Increment(1)
+	h.Compact()
+	if cap(h.BucketBoundaries()) != 2 || cap(h.BucketCounts()) != 3 || h.BucketCount(1) != 1 {
+		t.Error("Expected compacted slices Got", cap(h.BucketBoundaries()), cap(h.BucketCounts()))
+	}
+}
+
+func TestFloatHistogramNaNInf(t *testing.T) {
+	for _, invalid := range [][]float64{{math.NaN()}, {0, math.Inf(1)}, {math.Inf(-1), 0}} {
+		if _, err := NewFloatBoundaries(invalid); err == nil {
+			t.Error("Expected error for", invalid)
+		}
+	}
+	h, _ := NewFloatBoundaries([]float64{0, 1})
+	h.Increment(0.5)
+	h.Increment(math.NaN())
+	h.Increment(math.Inf(1))
+	h.Increment(math.Inf(-1))
+	if h.NaNCount() != 1 || h.Count() != 3 || h.Total() != 0.5 {
+		t.Error("Unexpected NaN count", h.NaNCount(), "count", h.Count(), "or total", h.Total())
+	}
+	if h.BucketCount(0) != 1 || h.BucketCount(2) != 1 {
+		t.Error("Expected infinite samples in open ended buckets")
+	}
+}
+
+func TestProbabilities(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	if !reflect.DeepEqual([]float64{0, 0, 0}, h.Probabilities()) {
+		t.Error("Expected zeros Got", h.Probabilities())
+	}
+	for i := int64(0); i < 30; i++ {
+		h.Increment(i * i)
+	}
+	var sum float64
+	for _, p := range h.Probabilities() {
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Error("Expected probabilities to sum to 1 Got", sum)
+	}
+}
+
+func TestAppendPrependBoundary(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(15)
+	if err := h.PrependBoundary(10); err == nil {
+		t.Error("Expected error")
+	}
+	if err := h.PrependBoundary(0); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err := h.AppendBoundary(30); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{0, 10, 20, 30}, h.BucketBoundaries()) ||
+		!reflect.DeepEqual([]int64{0, 0, 1, 0, 0}, h.BucketCounts()) {
+		t.Error("Unexpected boundaries", h.BucketBoundaries(), "or counts", h.BucketCounts())
+	}
+	h.Increment(-5)
+	if err := h.PrependBoundary(-10); err == nil {
+		t.Error("Expected error for non-empty first bucket")
+	}
+	if h.BucketIndex(-5) != 0 || h.BucketIndex(25) != 3 {
+		t.Error("Unexpected bucket index")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(5)
+	h.Increment(15)
+	if corrections := h.Repair(); len(corrections) != 0 {
+		t.Error("Expected no corrections Got", corrections)
+	}
+	h.bucketCounts[2] = -1
+	h.bucketTotals = h.bucketTotals[:2]
+	h.numSamples = 7
+	corrections := h.Repair()
+	if len(corrections) != 3 {
+		t.Error("Expected 3 corrections Got", corrections)
+	}
+	if !reflect.DeepEqual([]int64{1, 1, 0}, h.BucketCounts()) || h.Count() != 2 || h.Total() != 20 {
+		t.Error("Unexpected counts", h.BucketCounts(), h.Count(), h.Total())
+	}
+}
+
+func TestPeaks(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	for value, count := range map[int64]int{5: 10, 15: 30, 25: 10, 65: 8, 75: 20, 85: 17} {
+		for i := 0; i < count; i++ {
+			h.Increment(value)
+		}
+	}
+	if peaks := h.Peaks(0.1); !reflect.DeepEqual([]int{2, 8}, peaks) {
+		t.Error("Expected [2 8] Got", peaks)
+	}
+	if peaks := h.Peaks(0.5); !reflect.DeepEqual([]int{2}, peaks) {
+		t.Error("Expected [2] Got", peaks)
+	}
+}
+
+func TestSparse(t *testing.T) {
+	h, _ := New(Range(0, 10000, 1))
+	h.Increment(-5)
+	h.Increment(42)
+	h.Increment(42)
+	h.Increment(20000)
+	data, err := h.MarshalSparse()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	var other Histogram
+	if err := other.UnmarshalSparse(data); err != nil || !other.Equal(h) {
+		t.Error("Expected equal histogram after round trip", err)
+	}
+	if err := other.UnmarshalSparse(data[:len(data)-1]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+	h.numSamples++
+	data, _ = h.MarshalSparse()
+	if err := other.UnmarshalSparse(data); err != inconsistentSumError {
+		t.Error("Expected", inconsistentSumError, "Got", err)
+	}
+}
+
+func TestExactQuantile(t *testing.T) {
+	h, _ := New([]int64{0, 100}, WithReservoir(4))
+	for _, value := range []int64{3, 97, 41, 12} {
+		h.Increment(value)
+	}
+	for _, c := range []struct {
+		q        float64
+		expected int64
+	}{{0, 3}, {0.25, 3}, {0.5, 12}, {0.75, 41}, {1, 97}} {
+		if value, exact := h.ExactQuantile(c.q); !exact || value != c.expected {
+			t.Error("ExactQuantile", c.q, "Expected", c.expected, "Got", value, exact)
+		}
+	}
+	h.Increment(50)
+	if value, exact := h.ExactQuantile(0.5); exact || value != 50 {
+		t.Error("Expected estimated 50 Got", value, exact)
+	}
+	h.Clear()
+	h.Increment(7)
+	if value, exact := h.Copy().ExactQuantile(0.5); !exact || value != 7 {
+		t.Error("Expected exact 7 Got", value, exact)
+	}
+}
+
+func TestOccupiedBuckets(t *testing.T) {
+	h, _ := New([]int64{10, 20, 30})
+	h.Increment(5)
+	h.Increment(6)
+	h.Increment(35)
+	if occupied := h.OccupiedBuckets(); occupied != 2 {
+		t.Error("Expected 2 Got", occupied)
+	}
+}
+
+func TestShift(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(12)
+	h.Increment(25)
+	shifted, err := h.Shift(-10)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{0, 10}, shifted.BucketBoundaries()) ||
+		!reflect.DeepEqual([]int64{0, 1, 1}, shifted.BucketCounts()) ||
+		shifted.BucketTotal(1) != 2 || shifted.Total() != 17 {
+		t.Error("Unexpected shift", shifted.BucketBoundaries(), shifted.BucketCounts(), shifted.Total())
+	}
+	if _, err := h.Shift(math.MaxInt64 - 15); err == nil {
+		t.Error("Expected overflow error")
+	}
+}
+
+func TestVariance(t *testing.T) {
+	h, _ := New([]int64{10})
+	if h.Variance() != 0 {
+		t.Error("Expected 0 for empty histogram")
+	}
+	var wg sync.WaitGroup
+	for _, value := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+		wg.Add(1)
+		go func(value int64) {
+			defer wg.Done()
+			h.AtomicIncrement(value)
+		}(value)
+	}
+	wg.Wait()
+	if h.Variance() != 4 || h.StdDev() != 2 {
+		t.Error("Expected variance 4 Got", h.Variance())
+	}
+	shifted, _ := h.Shift(100)
+	if shifted.Variance() != 4 {
+		t.Error("Expected shifted variance 4 Got", shifted.Variance())
+	}
+}
+
+func TestGrow(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(15)
+	grown, err := h.Grow([]int64{0, 10, 20, 30})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{0, 0, 1, 0, 0}, grown.BucketCounts()) || grown.Count() != 1 || grown.Total() != 15 {
+		t.Error("Unexpected counts", grown.BucketCounts())
+	}
+	if _, err := h.Grow([]int64{0, 20, 30}); err == nil {
+		t.Error("Expected error for non-superset")
+	}
+	if _, err := h.Grow([]int64{10, 15, 20}); err == nil {
+		t.Error("Expected error for splitting a non-empty bucket")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	if h.Summary() != (Summary{}) {
+		t.Error("Expected zero summary")
+	}
+	for i := int64(0); i < 100; i++ {
+		h.Increment(i)
+	}
+	s := h.Summary()
+	for _, c := range []struct {
+		q     float64
+		value int64
+	}{{0, s.Min}, {0.5, s.P50}, {0.9, s.P90}, {0.99, s.P99}, {1, s.Max}} {
+		if expected, _ := h.Quantile(c.q); expected != c.value {
+			t.Error("Quantile", c.q, "Expected", expected, "Got", c.value)
+		}
+	}
+	if s.Count != 100 || s.Total != 4950 || s.Mean != 49.5 || s.StdDev != h.StdDev() {
+		t.Error("Unexpected summary", s)
+	}
+}
+
+func TestAtomicBucketAverage(t *testing.T) {
+	h, _ := New([]int64{10})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			h.AtomicIncrement(4)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		// Total is loaded before count, so a concurrent increment can only lower the average
+		if average := h.AtomicBucketAverage(0); average > 4 {
+			t.Error("Unexpected average", average)
+		}
+	}
+	wg.Wait()
+	if h.AtomicBucketAverage(0) != 4 {
+		t.Error("Expected 4 Got", h.AtomicBucketAverage(0))
+	}
+}
+
+func TestRelativeErrorBoundaries(t *testing.T) {
+	boundaries, err := RelativeErrorBoundaries(1, 100, 0.5)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected := []int64{1, 2, 3, 5, 8, 11, 17, 26, 38, 58, 86, 100}
+	if !reflect.DeepEqual(expected, boundaries) {
+		t.Error("Expected", expected, "Got", boundaries)
+	}
+	if _, err := New(boundaries); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if _, err := RelativeErrorBoundaries(0, 100, 0.1); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err := RelativeErrorBoundaries(1, 100, 0); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err := RelativeErrorBoundaries(1, 100, 1e-17); err == nil {
+		t.Error("Expected error for alpha lost in 1 + alpha")
+	}
+	if _, err := RelativeErrorBoundaries(1, math.MaxInt64, 1e-9); err == nil {
+		t.Error("Expected error for too many boundaries")
+	}
+}
+
+func TestForEachBucket(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(5)
+	h.Increment(25)
+	h.Increment(26)
+	var forward, reverse []int
+	h.ForEachBucket(func(index int, low, high, count, total int64) {
+		forward = append(forward, index)
+	})
+	var atOrAbove []int64
+	var cumulative int64
+	h.ForEachBucketReverse(func(index int, low, high, count, total int64) {
+		reverse = append(reverse, index)
+		cumulative += count
+		atOrAbove = append(atOrAbove, cumulative)
+	})
+	if !reflect.DeepEqual([]int{0, 1, 2}, forward) || !reflect.DeepEqual([]int{2, 1, 0}, reverse) {
+		t.Error("Unexpected order", forward, reverse)
+	}
+	if !reflect.DeepEqual([]int64{2, 2, 3}, atOrAbove) {
+		t.Error("Expected [2 2 3] Got", atOrAbove)
+	}
+}
+
+func TestClampValues(t *testing.T) {
+	h, _ := New([]int64{0, 10})
+	h.IncrementClamped(-1000)
+	h.IncrementClamped(5)
+	h.IncrementClamped(1000000)
+	if !reflect.DeepEqual([]int64{0, 2, 1}, h.BucketCounts()) || h.Total() != 15 {
+		t.Error("Unexpected counts", h.BucketCounts(), "or total", h.Total())
+	}
+	clamped, _ := New([]int64{0, 10}, WithClampValues())
+	clamped.Increment(-1000)
+	clamped.AtomicIncrement(5)
+	clamped.Increment(1000000)
+	if !clamped.Equal(h) {
+		t.Error("Expected clamped histogram to equal", h, "Got", clamped)
+	}
+}
+
+func TestApproxEqual(t *testing.T) {
+	h, _ := New([]int64{10})
+	other, _ := New([]int64{10})
+	h.Increment(5)
+	other.Increment(6)
+	if !h.ApproxEqual(other, 1) || h.ApproxEqual(other, 0) {
+		t.Error("Unexpected ApproxEqual")
+	}
+	different, _ := New([]int64{11})
+	if h.ApproxEqual(different, 100) {
+		t.Error("Expected different boundaries to differ")
+	}
+}
+
+func TestIncrementOrReject(t *testing.T) {
+	h, _ := New([]int64{0, 100})
+	inRange := func(val int64) bool {
+		return val >= 0 && val < 100
+	}
+	for _, value := range []int64{-1, 5, 50, 100, 99} {
+		h.IncrementOrReject(value, inRange)
+	}
+	if h.Count() != 3 || h.Rejected() != 2 || h.Copy().Rejected() != 2 {
+		t.Error("Unexpected count", h.Count(), "or rejected", h.Rejected())
+	}
+	h.Clear()
+	if h.Rejected() != 0 {
+		t.Error("Expected rejected to be cleared")
+	}
+}
+
+func TestFoldInto(t *testing.T) {
+	fine, _ := New(Range(10, 50, 10))
+	for i := int64(0); i < 60; i++ {
+		fine.Increment(i)
+	}
+	coarse, _ := New([]int64{20, 40})
+	if err := fine.FoldInto(coarse); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{20, 20, 20}, coarse.BucketCounts()) || coarse.Total() != fine.Total() {
+		t.Error("Unexpected counts", coarse.BucketCounts())
+	}
+	if coarse.BucketTotal(1) != 590 {
+		t.Error("Expected 590 Got", coarse.BucketTotal(1))
+	}
+	other, _ := New([]int64{25})
+	if err := fine.FoldInto(other); err == nil {
+		t.Error("Expected error for non-subset boundaries")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := r.GetOrCreate("latency", []int64{10, 100})
+			if err != nil {
+				t.Error("Unexpected error:", err)
+				return
+			}
+			h.AtomicIncrement(50)
+		}()
+	}
+	wg.Wait()
+	if _, err := r.GetOrCreate("latency", []int64{10}); err == nil {
+		t.Error("Expected error for different boundaries")
+	}
+	snapshot := r.Snapshot()
+	if len(snapshot) != 1 || snapshot["latency"].Count() != 8 {
+		t.Error("Unexpected snapshot", snapshot)
+	}
+}
+
+func TestCenterOfMass(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	h.Increment(-100)
+	if _, ok := h.CenterOfMass(); ok {
+		t.Error("Expected not ok")
+	}
+	h.Increment(1)
+	h.Increment(11)
+	h.Increment(12)
+	if center, ok := h.CenterOfMass(); !ok || center != 35.0/3 {
+		t.Error("Expected", 35.0/3, "Got", center, ok)
+	}
+}
+
+func TestIndexErr(t *testing.T) {
+	h, _ := New([]int64{10})
+	h.Increment(15)
+	if low, high, err := h.BucketRangesErr(1); err != nil || low != 10 || high != math.MaxInt64 {
+		t.Error("Unexpected range", low, high, err)
+	}
+	if count, err := h.BucketCountErr(1); err != nil || count != 1 {
+		t.Error("Unexpected count", count, err)
+	}
+	for _, index := range []int{-1, 2} {
+		if _, _, err := h.BucketRangesErr(index); err == nil {
+			t.Error("Expected error for", index)
+		}
+		if _, err := h.BucketCountErr(index); err == nil {
+			t.Error("Expected error for", index)
+		}
+		if _, err := h.BucketTotalErr(index); err == nil {
+			t.Error("Expected error for", index)
+		}
+		if _, err := h.BucketAverageErr(index); err == nil {
+			t.Error("Expected error for", index)
+		}
+	}
+}
+
+func TestSplitBucket(t *testing.T) {
+	h, _ := New([]int64{0, 100})
+	for i := int64(0); i < 100; i++ {
+		h.Increment(i)
+	}
+	h.SetLabels([]string{"low", "mid", "high"})
+	if err := h.SplitBucket(1, 25); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{0, 25, 100}, h.BucketBoundaries()) ||
+		!reflect.DeepEqual([]int64{0, 25, 75, 0}, h.BucketCounts()) ||
+		h.BucketTotal(1)+h.BucketTotal(2) != 4950 || h.BucketLabel(2) != "mid" {
+		t.Error("Unexpected split", h.BucketBoundaries(), h.BucketCounts())
+	}
+	if err := h.SplitBucket(0, -5); err == nil {
+		t.Error("Expected error for open ended bucket")
+	}
+	if err := h.SplitBucket(1, 25); err == nil {
+		t.Error("Expected error for boundary outside bucket")
+	}
+}
+
+func TestMergeBucket(t *testing.T) {
+	h, _ := New([]int64{0, 25, 100})
+	h.Increment(10)
+	h.Increment(50)
+	h.Increment(150)
+	if err := h.MergeBucket(1); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{0, 100}, h.BucketBoundaries()) ||
+		!reflect.DeepEqual([]int64{0, 2, 1}, h.BucketCounts()) || h.BucketTotal(1) != 60 {
+		t.Error("Unexpected merge", h.BucketBoundaries(), h.BucketCounts())
+	}
+	if err := h.MergeBucket(2); err == nil {
+		t.Error("Expected error for last bucket")
+	}
+	h.MergeBucket(0)
+	if err := h.MergeBucket(0); err == nil {
+		t.Error("Expected error for last boundary")
+	}
+}
+
+func TestBucketWidth(t *testing.T) {
+	h, _ := New([]int64{0, 5, 25, 30})
+	if h.MinBucketWidth() != 5 || h.MaxBucketWidth() != 20 {
+		t.Error("Unexpected widths", h.MinBucketWidth(), h.MaxBucketWidth())
+	}
+	h, _ = New([]int64{0})
+	if h.MinBucketWidth() != 0 || h.MaxBucketWidth() != 0 {
+		t.Error("Expected 0 widths")
+	}
+}
+
+func TestSizeHistogram(t *testing.T) {
+	h, _ := New([]int64{4, 16})
+	var buf bytes.Buffer
+	w := NewSizeHistogram(&buf, h)
+	fmt.Fprint(w, "ab")
+	fmt.Fprint(w, "abcdefgh")
+	fmt.Fprint(w, "abcdefghijklmnopqrstuvwxyz")
+	if buf.Len() != 36 || !reflect.DeepEqual([]int64{1, 1, 1}, w.Histogram().BucketCounts()) {
+		t.Error("Unexpected write sizes", w.Histogram().BucketCounts())
+	}
+}
+
+func TestCSV(t *testing.T) {
+	h, _ := New([]int64{1, 2})
+	h.Increment(0)
+	h.Increment(1)
+	h.Increment(1)
+	h.Increment(5)
+	var buf bytes.Buffer
+	if err := h.WriteCSV(&buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected := "low,high,count,total,average\n-inf,1,1,0,0\n1,2,2,2,1\n2,+inf,1,5,5\n"
+	if buf.String() != expected {
+		t.Error("Expected", expected, "Got", buf.String())
+	}
+	other, err := ReadCSV(&buf)
+	if err != nil || !other.Equal(h) {
+		t.Error("Expected equal histogram after round trip", err)
+	}
+	if _, err := ReadCSV(strings.NewReader(",5,1,1,1\n5,,0,0,0\n")); err != nil {
+		t.Error("Unexpected error for empty open ends:", err)
+	}
+	for _, invalid := range []string{
+		"-inf,5,1,1,1\n5,3,0,0,0\n3,+inf,0,0,0\n",
+		"-inf,5,1,1,1\n6,+inf,0,0,0\n",
+		"-inf,5,1,1,1\n",
+	} {
+		if _, err := ReadCSV(strings.NewReader(invalid)); err == nil {
+			t.Error("Expected error for", invalid)
+		}
+	}
+}
+
+func TestDurationHistogram(t *testing.T) {
+	d, err := NewDurationHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	for i := 0; i < 10; i++ {
+		d.Observe(time.Duration(i+1) * time.Millisecond)
+	}
+	if average := d.Average(); average != 5500*time.Microsecond {
+		t.Error("Expected 5.5ms Got", average)
+	}
+	if p50, err := d.Quantile(0.5); err != nil || p50 != 6*time.Millisecond {
+		t.Error("Expected 6ms Got", p50, err)
+	}
+	if d.Histogram().Count() != 10 {
+		t.Error("Expected 10 samples Got", d.Histogram().Count())
+	}
+	// Average of 1ns and 2ns is 1.5ns, which rounds to 2ns
+	rounded, _ := NewDurationHistogram([]time.Duration{time.Second})
+	rounded.Observe(1)
+	rounded.Observe(2)
+	if average := rounded.Average(); average != 2 {
+		t.Error("Expected 2ns Got", average)
+	}
+}
+
+func TestNormalizedBoundaries(t *testing.T) {
+	h, _ := New([]int64{100, 150, 200, 300})
+	if normalized := h.NormalizedBoundaries(); !reflect.DeepEqual([]float64{0, 0.25, 0.5, 1}, normalized) {
+		t.Error("Expected [0 0.25 0.5 1] Got", normalized)
+	}
+	h, _ = New([]int64{100})
+	if normalized := h.NormalizedBoundaries(); len(normalized) != 0 {
+		t.Error("Expected empty Got", normalized)
+	}
+}
+
+func TestTime(t *testing.T) {
+	h, _ := New([]int64{int64(time.Millisecond), int64(time.Hour)})
+	func() {
+		defer h.Time()()
+		time.Sleep(2 * time.Millisecond)
+	}()
+	if h.BucketCount(1) != 1 {
+		t.Error("Expected elapsed time in [1ms, 1h) Got", h.BucketCounts())
+	}
+}
+
+func TestCoefficientOfVariation(t *testing.T) {
+	h, _ := New([]int64{10})
+	if h.CoefficientOfVariation() != 0 {
+		t.Error("Expected 0 for empty histogram")
+	}
+	for _, value := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.Increment(value)
+	}
+	if cv := h.CoefficientOfVariation(); cv != 0.4 {
+		t.Error("Expected 0.4 Got", cv)
+	}
+}
+
+func TestNewCopiesBoundaries(t *testing.T) {
+	boundaries := []int64{10, 20}
+	h, _ := New(boundaries)
+	boundaries[0] = 30
+	h.Increment(15)
+	if !reflect.DeepEqual([]int64{10, 20}, h.BucketBoundaries()) || h.BucketCount(1) != 1 {
+		t.Error("Expected boundaries to be unchanged Got", h.BucketBoundaries())
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	if _, err := NewTemplate([]int64{2, 1}); err == nil {
+		t.Error("Expected error")
+	}
+	template, _ := NewTemplate([]int64{0, 10}, WithClampValues())
+	if err := template.SetLabels([]string{"low", "mid", "high"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	a, b := template.New(), template.New()
+	a.Increment(100)
+	if b.Count() != 0 || a.BucketCount(2) != 1 || a.Total() != 10 || b.BucketLabel(1) != "mid" {
+		t.Error("Unexpected histograms from template", a, b)
+	}
+	if err := a.MergeInto(b); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestDistinctCount(t *testing.T) {
+	h, _ := New([]int64{10}, WithDistinctCount())
+	h.Increment(3)
+	h.Increment(3)
+	h.Increment(3)
+	h.Increment(4)
+	h.Increment(12)
+	c := h.Copy()
+	h.Increment(5)
+	if c.BucketDistinct(0) != 2 || h.BucketDistinct(0) != 3 || h.BucketDistinct(1) != 1 {
+		t.Error("Unexpected distinct counts", c.BucketDistinct(0), h.BucketDistinct(0), h.BucketDistinct(1))
+	}
+	h.Clear()
+	if h.BucketDistinct(0) != 0 {
+		t.Error("Expected distinct count to be cleared")
+	}
+	// Splitting and merging back restores the number of buckets but not the sets
+	h, _ = New([]int64{0, 10, 20}, WithDistinctCount())
+	h.Increment(3)
+	h.Increment(7)
+	h.SplitBucket(1, 5)
+	h.MergeBucket(1)
+	if distinct := h.BucketDistinct(1); distinct != 0 {
+		t.Error("Expected 0 Got", distinct)
+	}
+}
+
+func TestBucketPercentileRange(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	if low, high := h.BucketPercentileRange(1); low != 0 || high != 0 {
+		t.Error("Expected zeros Got", low, high)
+	}
+	h.Increment(5)
+	h.Increment(15)
+	h.Increment(16)
+	h.Increment(25)
+	if low, high := h.BucketPercentileRange(1); low != 25 || high != 75 {
+		t.Error("Expected 25 75 Got", low, high)
+	}
+	if low, high := h.BucketPercentileRange(2); low != 75 || high != 100 {
+		t.Error("Expected 75 100 Got", low, high)
+	}
+}
+
+func TestMergeWithReport(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	h.Increment(5)
+	aligned, _ := New([]int64{0, 5, 10, 20})
+	aligned.Increment(-1)
+	aligned.Increment(7)
+	aligned.Increment(30)
+	merged, report := h.MergeWithReport(aligned)
+	if report.Redistributed != 0 || !reflect.DeepEqual([]int64{1, 2, 0, 1}, merged.BucketCounts()) {
+		t.Error("Unexpected aligned merge", merged.BucketCounts(), report)
+	}
+	unaligned, _ := New([]int64{-10, 5, 15})
+	for i := 0; i < 10; i++ {
+		unaligned.Increment(10)
+	}
+	unaligned.Increment(-20)
+	merged, report = h.MergeWithReport(unaligned)
+	if report.Redistributed != 10 || !reflect.DeepEqual([]int64{1, 6, 5, 0}, merged.BucketCounts()) {
+		t.Error("Unexpected unaligned merge", merged.BucketCounts(), report)
+	}
+	if merged := h.Merge(unaligned); merged.Count() != 12 {
+		t.Error("Expected 12 samples Got", merged.Count())
+	}
+}
+
+func TestUnsignedHistogram(t *testing.T) {
+	h, err := NewUnsigned([]int64{0, 10})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	h.bucketCounts[1] = math.MaxInt64
+	h.numSamples = math.MaxInt64
+	h.Increment(5)
+	h.AtomicIncrement(-5)
+	if h.BucketCount(1) != math.MaxInt64+1 || h.Count() != math.MaxInt64+2 || h.BucketCount(0) != 1 {
+		t.Error("Unexpected counts", h.BucketCount(0), h.BucketCount(1), h.Count())
+	}
+	other, _ := NewUnsigned([]int64{0, 10})
+	other.Increment(20)
+	h.IncrementFromHistogram(other)
+	if h.BucketCount(2) != 1 || h.Total() != 20 {
+		t.Error("Unexpected merge", h.BucketCount(2), h.Total())
+	}
+}
+
+func TestUnmarshalJSONStrict(t *testing.T) {
+	h, err := UnmarshalJSONStrict([]byte(`{"boundaries":[1,2],"counts":[1,2,1],"totals":[0,2,5]}`))
+	if err != nil || h.Count() != 4 || h.Total() != 7 {
+		t.Error("Unexpected histogram", h, err)
+	}
+	for _, invalid := range []string{
+		`{"boundaries":[2,1],"counts":[0,0,0],"totals":[0,0,0]}`,
+		`{"boundaries":[1,2],"counts":[0,0],"totals":[0,0,0]}`,
+		`{"boundaries":[1,2],"counts":[0,-1,0],"totals":[0,0,0]}`,
+		`{"boundaries":[1,2],"counts":[0,1,0],"totals":[0,5,0]}`,
+		`{"boundaries":[1,2],"counts":[0,0,0],"totals":[0,1,0]}`,
+		`{"boundaries":[1,2],"counts":[0,0,0],"totals":[0,0,0],"extra":1}`,
+		`{"boundaries":[1,2],"counts":[0,0,0],"totals":[0,0,0]} {}`,
+		`{"boundaries":[1,2],"counts":[0,0,0],"totals":[0,0,0]}}`,
+		`{"boundaries":[1,2],"counts":[0,0,0],"totals":[0,0,0]}]`,
+	} {
+		if _, err := UnmarshalJSONStrict([]byte(invalid)); err == nil {
+			t.Error("Expected error for", invalid)
+		}
+	}
+}
+
+func TestConvertUnits(t *testing.T) {
+	h, _ := New([]int64{-1500, 1000, 5000})
+	h.Increment(1200)
+	h.Increment(4900)
+	converted, err := h.ConvertUnits(1000)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{-2, 1, 5}, converted.BucketBoundaries()) ||
+		!reflect.DeepEqual(h.BucketCounts(), converted.BucketCounts()) || converted.Total() != 6 {
+		t.Error("Unexpected conversion", converted.BucketBoundaries(), converted.BucketCounts(), converted.Total())
+	}
+	if _, err := h.ConvertUnits(10000); err == nil {
+		t.Error("Expected error for collapsed boundaries")
+	}
+	if _, err := h.ConvertUnits(0); err == nil {
+		t.Error("Expected error for zero divisor")
+	}
+	// Totals 3 and 23 round to 2 and 12, while the total 26 would round to 13
+	h, _ = New([]int64{10})
+	h.Increment(3)
+	h.Increment(11)
+	h.Increment(12)
+	converted, _ = h.ConvertUnits(2)
+	if err := converted.CheckInvariants(true); err != nil || converted.Total() != 14 {
+		t.Error("Expected total 14 Got", converted.Total(), err)
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	h, _ := New([]int64{-1000, 1, 2})
+	h.Increment(1)
+	h.Increment(-5000)
+	data, err := h.MarshalMsgpack()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	var other Histogram
+	if err := other.UnmarshalMsgpack(data); err != nil || !other.Equal(h) {
+		t.Error("Expected equal histogram after round trip", err)
+	}
+	large, _ := New(Range(0, 100000, 1))
+	large.Increment(math.MaxInt64)
+	data, _ = large.MarshalMsgpack()
+	if err := other.UnmarshalMsgpack(data); err != nil || !other.Equal(large) {
+		t.Error("Expected equal histogram after round trip", err)
+	}
+	if err := other.UnmarshalMsgpack(data[:len(data)-1]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+	if err := other.UnmarshalMsgpack([]byte{0x81, 0xa1, 'x', 0x90}); err == nil {
+		t.Error("Expected error for missing fields")
+	}
+}
+
+func TestBoundaryPercentiles(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	if !reflect.DeepEqual([]float64{0, 0}, h.BoundaryPercentiles()) {
+		t.Error("Expected zeros Got", h.BoundaryPercentiles())
+	}
+	h.Increment(5)
+	h.Increment(15)
+	h.Increment(16)
+	h.Increment(25)
+	if !reflect.DeepEqual([]float64{25, 75}, h.BoundaryPercentiles()) {
+		t.Error("Expected [25 75] Got", h.BoundaryPercentiles())
+	}
+}
+
+func TestSafeDecrementFromHistogram(t *testing.T) {
+	h, _ := New([]int64{10})
+	baseline, _ := New([]int64{10})
+	h.Increment(1)
+	h.Increment(11)
+	baseline.Increment(2)
+	if err := h.SafeDecrementFromHistogram(baseline); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err := h.SafeDecrementFromHistogram(baseline); err == nil {
+		t.Error("Expected error")
+	}
+	if !reflect.DeepEqual([]int64{0, 1}, h.BucketCounts()) || h.Count() != 1 || h.Total() != 10 {
+		t.Error("Unexpected counts", h.BucketCounts(), h.Count(), h.Total())
+	}
+}
+
+func TestBucketSnapshots(t *testing.T) {
+	h, _ := New([]int64{10})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			h.AtomicIncrement(3)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		counts, totals := h.BucketCountsSnapshot(), h.BucketTotalsSnapshot()
+		if len(counts) != 2 || len(totals) != 2 {
+			t.Error("Unexpected snapshot lengths")
+		}
+	}
+	wg.Wait()
+	counts := h.BucketCountsSnapshot()
+	counts[0] = 0
+	if h.BucketCount(0) != 1000 || h.BucketTotalsSnapshot()[0] != 3000 {
+		t.Error("Unexpected snapshot", h.BucketCounts(), h.BucketTotalsSnapshot())
+	}
+}
+
+func TestValueWeightedQuantile(t *testing.T) {
+	h, _ := New([]int64{0, 10, 100, 1000})
+	if _, err := h.ValueWeightedQuantile(0.5); err == nil {
+		t.Error("Expected error for empty histogram")
+	}
+	for i := 0; i < 9; i++ {
+		h.Increment(5)
+	}
+	h.Increment(955)
+	if value, err := h.ValueWeightedQuantile(0.5); err != nil || value != 529 {
+		t.Error("Expected 529 Got", value, err)
+	}
+	if value, _ := h.Quantile(0.5); value != 6 {
+		t.Error("Expected count-weighted 6 Got", value)
+	}
+	if _, err := h.ValueWeightedQuantile(-1); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(15)
+	boundaries, counts, totals := h.Columns()
+	if !reflect.DeepEqual([]int64{10, 20}, boundaries) ||
+		!reflect.DeepEqual([]int64{0, 1, 0}, counts) ||
+		!reflect.DeepEqual([]int64{0, 15, 0}, totals) {
+		t.Error("Unexpected columns", boundaries, counts, totals)
+	}
+	counts[1] = 5
+	if h.BucketCount(1) != 1 {
+		t.Error("Expected columns to be copies")
+	}
+}
+
+func TestSymLogRange(t *testing.T) {
+	boundaries, err := SymLogRange(5000, 3)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	expected := []int64{-5000, -500, -50, 0, 50, 500, 5000}
+	if !reflect.DeepEqual(expected, boundaries) {
+		t.Error("Expected", expected, "Got", boundaries)
+	}
+	if _, err := New(boundaries); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if _, err := SymLogRange(100, 4); err == nil {
+		t.Error("Expected error for too many decades")
+	}
+}
+
+func TestMergeWithWeights(t *testing.T) {
+	a, _ := New([]int64{10})
+	b, _ := New([]int64{10})
+	a.Increment(1)
+	b.Increment(20)
+	merged, err := MergeWithWeights([]*Histogram{a, b}, []int64{3, 1})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual([]int64{3, 1}, merged.BucketCounts()) || merged.Count() != 4 || merged.Total() != 23 {
+		t.Error("Unexpected merge", merged.BucketCounts(), merged.Count(), merged.Total())
+	}
+	if a.Count() != 1 {
+		t.Error("Expected inputs to be unchanged")
+	}
+	if _, err := MergeWithWeights([]*Histogram{a, b}, []int64{1}); err == nil {
+		t.Error("Expected error for mismatched lengths")
+	}
+	c, _ := New([]int64{5})
+	if _, err := MergeWithWeights([]*Histogram{a, c}, []int64{1, 1}); err == nil {
+		t.Error("Expected error for mismatched boundaries")
+	}
+}
+
+func TestCountBetweenPercentiles(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	for i := int64(0); i < 25; i++ {
+		h.Increment(i)
+	}
+	if count := h.CountBetweenPercentiles(10, 90); count != 20 {
+		t.Error("Expected 20 Got", count)
+	}
+	if count := h.CountBetweenPercentiles(0, 100); count != 25 {
+		t.Error("Expected 25 Got", count)
+	}
+	if count := h.CountBetweenPercentiles(90, 10); count != 0 {
+		t.Error("Expected 0 for invalid range Got", count)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	ch := make(chan *Histogram)
+	go func() {
+		for i := int64(0); i < 4; i++ {
+			h, _ := New([]int64{10})
+			h.Increment(i * 5)
+			ch <- h
+		}
+		close(ch)
+	}()
+	h, err := Aggregate(context.Background(), ch)
+	if err != nil || !reflect.DeepEqual([]int64{2, 2}, h.BucketCounts()) || h.Total() != 30 {
+		t.Error("Unexpected aggregate", h, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Aggregate(ctx, make(chan *Histogram)); err != context.Canceled {
+		t.Error("Expected context.Canceled Got", err)
+	}
+	mismatched := make(chan *Histogram, 2)
+	a, _ := New([]int64{10})
+	b, _ := New([]int64{20})
+	mismatched <- a
+	mismatched <- b
+	close(mismatched)
+	if _, err := Aggregate(context.Background(), mismatched); err == nil {
+		t.Error("Expected error for mismatched boundaries")
+	}
+}
+
+func TestDecayingHistogram(t *testing.T) {
+	if _, err := NewDecayingHistogram([]int64{10}, 1.5); err == nil {
+		t.Error("Expected error for invalid decay")
+	}
+	d, _ := NewDecayingHistogram([]int64{10}, 0.5)
+	for i := 0; i < 4; i++ {
+		d.Observe(1)
+	}
+	d.Observe(20)
+	d.Observe(20)
+	h := d.Current()
+	// Old samples decayed to 1.875 * 0.25, recent ones count 1.5
+	if !reflect.DeepEqual([]int64{0, 2}, h.BucketCounts()) || h.BucketTotal(1) != 30 {
+		t.Error("Unexpected decayed counts", h.BucketCounts(), h.BucketTotal(1))
+	}
+}
+
+func TestWasserstein(t *testing.T) {
+	a, _ := New(Range(0, 100, 10))
+	b, _ := New(Range(0, 100, 10))
+	a.Increment(5)
+	b.Increment(25)
+	if distance, err := a.Wasserstein(b); err != nil || distance != 20 {
+		t.Error("Expected 20 Got", distance, err)
+	}
+	if distance, _ := a.Wasserstein(a); distance != 0 {
+		t.Error("Expected 0 Got", distance)
+	}
+	c, _ := New([]int64{0})
+	if _, err := a.Wasserstein(c); err == nil {
+		t.Error("Expected error for mismatched boundaries")
+	}
+}
+
+func TestSample(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	r := rand.New(rand.NewSource(1))
+	if val := h.Sample(r); val != 0 {
+		t.Error("Expected 0 Got", val)
+	}
+	h.Increment(5)
+	h.Increment(-100)
+	for _, val := range h.SampleN(r, 100) {
+		if index := h.BucketIndex(val); index != 0 && index != 1 {
+			t.Error("Expected sample in bucket 0 or 1 Got", val)
+		}
+	}
+	// Every sample falls into the bucket it was drawn from
+	for _, opts := range [][]Option{nil, {WithUpperClosed()}} {
+		for _, val := range []int64{-100, 0, 5, 10, 15, 20, 25} {
+			single, _ := New([]int64{0, 10, 20}, opts...)
+			single.Increment(val)
+			for i := 0; i < 10; i++ {
+				if sample := single.Sample(r); single.BucketIndex(sample) != single.BucketIndex(val) {
+					t.Error("Expected sample in bucket", single.BucketIndex(val), "Got", sample)
+				}
+			}
+		}
+	}
+	h.Clear()
+	h.Increment(25)
+	h.Increment(30)
+	h.Increment(35)
+	if samples := h.SampleN(r, 3); !reflect.DeepEqual(samples, []int64{20, 20, 20}) {
+		t.Error("Expected [20 20 20] Got", samples)
+	}
+}
+
+func TestWithUpperClosed(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20}, WithUpperClosed())
+	for _, val := range []int64{0, 10, 11, 20, 21} {
+		h.Increment(val)
+	}
+	h.AtomicIncrement(-1)
+	if counts := h.BucketCounts(); !reflect.DeepEqual(counts, []int64{2, 1, 2, 1}) {
+		t.Error("Expected [2 1 2 1] Got", counts)
+	}
+	if index := h.Copy().BucketIndex(10); index != 1 {
+		t.Error("Expected 1 Got", index)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	if h, err := Combine(nil, nil); h != nil || err != nil {
+		t.Error("Expected nil Got", h, err)
+	}
+	var acc *Histogram
+	for _, val := range []int64{5, 15, 25} {
+		h, _ := New([]int64{10, 20})
+		h.Increment(val)
+		var err error
+		if acc, err = Combine(acc, h); err != nil {
+			t.Error("Unexpected error", err)
+		}
+		if h.Count() != 1 {
+			t.Error("Expected argument to be unchanged Got", h.Count())
+		}
+	}
+	if counts := acc.BucketCounts(); !reflect.DeepEqual(counts, []int64{1, 1, 1}) {
+		t.Error("Expected [1 1 1] Got", counts)
+	}
+	other, _ := New([]int64{10, 30})
+	if _, err := Combine(acc, other); err == nil {
+		t.Error("Expected error for mismatched boundaries")
+	}
+}
+
+func TestSignature(t *testing.T) {
+	a, _ := New([]int64{10, 20, 30, 40})
+	b, _ := New([]int64{10, 20, 30, 40})
+	c, _ := New([]int64{10, 20, 30, 40})
+	if signature := a.Signature(32); !reflect.DeepEqual(signature, make([]byte, 4)) {
+		t.Error("Expected all zeros Got", signature)
+	}
+	for i := 0; i < 100; i++ {
+		a.Increment(15)
+		b.Increment(15)
+		c.Increment(45)
+	}
+	b.Increment(5)
+	hamming := func(x, y []byte) int {
+		distance := 0
+		for i := range x {
+			for d := x[i] ^ y[i]; d != 0; d &= d - 1 {
+				distance++
+			}
+		}
+		return distance
+	}
+	if distance := hamming(a.Signature(32), b.Signature(32)); distance > 1 {
+		t.Error("Expected similar signatures Got distance", distance)
+	}
+	if distance := hamming(a.Signature(32), c.Signature(32)); distance != 24 {
+		t.Error("Expected 24 Got", distance)
+	}
+	if size := len(a.Signature(12)); size != 2 {
+		t.Error("Expected 2 Got", size)
+	}
+}
+
+func TestIncrementSampled(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.IncrementSampled(15, 0.1)
+	h.IncrementSampled(5, 0.3)
+	h.IncrementSampled(25, 1)
+	if counts := h.BucketCounts(); !reflect.DeepEqual(counts, []int64{3, 10, 1}) {
+		t.Error("Expected [3 10 1] Got", counts)
+	}
+	if total := h.Total(); total != 15*10+5*3+25 {
+		t.Error("Expected 190 Got", total)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for sample rate 0")
+		}
+	}()
+	h.IncrementSampled(15, 0)
+}
+
+func TestCheckInvariants(t *testing.T) {
+	h, _ := New([]int64{10, 20, 30})
+	h.Increment(15)
+	h.Increment(25)
+	if err := h.CheckInvariants(true); err != nil {
+		t.Error("Expected nil Got", err)
+	}
+	h.bucketBoundaries[2] = 20
+	h.bucketCounts[0] = -1
+	h.total = 0
+	err := h.CheckInvariants(false)
+	if err == nil || !errors.Is(err, invalidBoundariesError) || !errors.Is(err, inconsistentSumError) || errors.Is(err, negativeCountError) {
+		t.Error("Expected boundary and sum violations Got", err)
+	}
+	if err := h.CheckInvariants(true); !errors.Is(err, negativeCountError) {
+		t.Error("Expected negative count violation Got", err)
+	}
+	h.bucketTotals = h.bucketTotals[:2]
+	if err := h.CheckInvariants(false); !errors.Is(err, invalidLengthsError) {
+		t.Error("Expected length violation Got", err)
+	}
+}
+
+func TestCompressTo(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	for i := int64(0); i < 100; i++ {
+		h.Increment(90 + i%10)
+	}
+	h.Increment(5)
+	h.Increment(15)
+	if same, _ := h.CompressTo(h.Size()); same != h {
+		t.Error("Expected receiver when under budget")
+	}
+	if _, err := h.CompressTo(1); err == nil {
+		t.Error("Expected error for budget of 1 bucket")
+	}
+	p99, _ := h.Quantile(0.99)
+	compressed, err := h.CompressTo(5)
+	if err != nil || compressed.Size() != 5 || h.Size() != 12 {
+		t.Error("Expected 5 buckets and unchanged receiver Got", compressed.Size(), h.Size(), err)
+	}
+	if compressed.Count() != h.Count() || compressed.Total() != h.Total() {
+		t.Error("Expected count and total to be preserved")
+	}
+	if compressedP99, _ := compressed.Quantile(0.99); compressedP99 != p99 {
+		t.Error("Expected", p99, "Got", compressedP99)
+	}
+}
+
+func TestTotalBetweenPercentiles(t *testing.T) {
+	h, _ := New([]int64{10, 100, 1000})
+	if _, err := h.TotalBetweenPercentiles(90, 100); err == nil {
+		t.Error("Expected error for empty histogram")
+	}
+	for i := 0; i < 90; i++ {
+		h.Increment(5)
+	}
+	for i := 0; i < 10; i++ {
+		h.Increment(500)
+	}
+	if total, err := h.TotalBetweenPercentiles(90, 100); err != nil || total != 5000 {
+		t.Error("Expected 5000 Got", total, err)
+	}
+	if total, _ := h.TotalBetweenPercentiles(85, 95); total != 25+2500 {
+		t.Error("Expected 2525 Got", total)
+	}
+	if total, _ := h.TotalBetweenPercentiles(0, 100); total != h.Total() {
+		t.Error("Expected", h.Total(), "Got", total)
+	}
+	if _, err := h.TotalBetweenPercentiles(50, 10); err == nil {
+		t.Error("Expected error for inverted percentiles")
+	}
+}
+
+func TestFromCounts(t *testing.T) {
+	boundaries := []int64{10, 20}
+	counts := []int64{1, 2, 3}
+	h, err := FromCounts(boundaries, counts, []int64{5, 30, 75})
+	if err != nil {
+		t.Error("Unexpected error", err)
+	}
+	if h.Count() != 6 || h.Total() != 110 {
+		t.Error("Expected 6 110 Got", h.Count(), h.Total())
+	}
+	boundaries[0], counts[0] = 0, 100
+	if h.BucketBoundaries()[0] != 10 || h.BucketCount(0) != 1 {
+		t.Error("Expected inputs to be copied")
+	}
+	if _, err := FromCounts([]int64{10, 20}, []int64{1, 2}, []int64{1, 2, 3}); err == nil {
+		t.Error("Expected error for invalid lengths")
+	}
+	if _, err := FromCounts([]int64{20, 10}, []int64{1, 2, 3}, []int64{1, 2, 3}); err == nil {
+		t.Error("Expected error for invalid boundaries")
+	}
+}
+
+func TestWriteHeatmapFrame(t *testing.T) {
+	h, _ := New([]int64{10, 20})
+	h.Increment(5)
+	h.Increment(25)
+	h.Increment(30)
+	var buf bytes.Buffer
+	if err := h.WriteHeatmapFrame(&buf, time.UnixMilli(1700000000000)); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	expected := `{"time":1700000000000,"10":1,"20":0,"+Inf":2}` + "\n"
+	if buf.String() != expected {
+		t.Error("Expected", expected, "Got", buf.String())
+	}
+	var frame map[string]int64
+	if err := json.Unmarshal(buf.Bytes(), &frame); err != nil || frame["+Inf"] != 2 {
+		t.Error("Expected valid JSON Got", frame, err)
+	}
+}
+
+func TestSurvivalFunction(t *testing.T) {
+	h, _ := New([]int64{0, 100, 200})
+	if fraction := h.SurvivalFunction(50); fraction != 0 {
+		t.Error("Expected 0 Got", fraction)
+	}
+	for i := 0; i < 999; i++ {
+		h.Increment(50)
+	}
+	h.Increment(150)
+	if fraction := h.SurvivalFunction(149); fraction != 0.5/1000 {
+		t.Error("Expected 0.0005 Got", fraction)
+	}
+	if fraction := h.SurvivalFunction(199); fraction != 0 {
+		t.Error("Expected 0 Got", fraction)
+	}
+	if fraction := h.SurvivalFunction(-1); fraction != 1 {
+		t.Error("Expected 1 Got", fraction)
+	}
+	for _, val := range []int64{-5, 0, 49, 100, 150, 200, 250} {
+		if sum := h.countLess(val+1) + h.SurvivalFunction(val)*1000; math.Abs(sum-1000) > 1e-9 {
+			t.Error("Expected complement of countLess at", val, "Got", sum)
+		}
+	}
+}
+
+func TestCountAt(t *testing.T) {
+	h, _ := New([]int64{100, 200, 300})
+	h.Increment(150)
+	h.Increment(199)
+	h.Increment(350)
+	if count := h.CountAt(100); count != 2 {
+		t.Error("Expected 2 Got", count)
+	}
+	if count := h.CountAt(1000); count != 1 {
+		t.Error("Expected 1 Got", count)
+	}
+	if low, high := h.RangeAt(200); low != 200 || high != 300 {
+		t.Error("Expected 200 300 Got", low, high)
+	}
+	if low, high := h.RangeAt(-5); low != math.MinInt64 || high != 100 {
+		t.Error("Expected", int64(math.MinInt64), 100, "Got", low, high)
+	}
+}
+
+func TestMergeResidual(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	other, _ := New([]int64{5, 15})
+	for i := 0; i < 3; i++ {
+		other.Increment(11)
+	}
+	merged, report := h.MergeWithReport(other)
+	if report.Redistributed != 3 || report.Residual != 1 || report.TotalResidual != 1 {
+		t.Error("Expected 3 1 1 Got", report)
+	}
+	if merged.Count()+report.Residual != h.Count()+other.Count() {
+		t.Error("Expected count to be conserved with residual Got", merged.Count(), report.Residual)
+	}
+	if merged.Total()+report.TotalResidual != h.Total()+other.Total() {
+		t.Error("Expected total to be conserved with residual Got", merged.Total(), report.TotalResidual)
+	}
+}
+
+func TestQuantileCumulative(t *testing.T) {
+	h, _ := New(Range(0, 1000, 10), WithCumulativeCounts())
+	empty, _ := New(Range(0, 1000, 10))
+	r := rand.New(rand.NewSource(1))
+	check := func() {
+		for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.9, 0.99, 1} {
+			// QuantileOf with more than one histogram walks the buckets linearly
+			expected, _ := QuantileOf(q, h, empty)
+			if value, _ := h.Quantile(q); value != expected {
+				t.Error("Expected", expected, "Got", value, "for", q)
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		h.Increment(r.Int63n(1200) - 100)
+		if i%100 == 0 {
+			check()
+		}
+	}
+	h.AtomicIncrement(500)
+	check()
+	h.Scale(0.5)
+	check()
+	h.Clear()
+	h.Increment(505)
+	check()
+	h.IncrementSampled(5, 0.5)
+	check()
+	h.bucketCounts[1] = -1
+	h.numSamples--
+	h.cumulativeCounts = nil
+	check()
+}
+
+func TestFiniteFraction(t *testing.T) {
+	h, _ := New([]int64{0, 100})
+	if fraction := h.FiniteFraction(); fraction != 0 {
+		t.Error("Expected 0 Got", fraction)
+	}
+	for i := int64(0); i < 8; i++ {
+		h.Increment(i * 10)
+	}
+	h.Increment(-1)
+	h.Increment(100)
+	if fraction := h.FiniteFraction(); fraction != 0.8 {
+		t.Error("Expected 0.8 Got", fraction)
+	}
+}
+
+func TestIncrementSortedFrom(t *testing.T) {
+	parse := func(b []byte) (int64, error) {
+		return strconv.ParseInt(string(b), 10, 64)
+	}
+	input := "-5\n0\n0\n9\n\n10\n25\n40\n"
+	h, _ := New([]int64{0, 10, 20})
+	if err := h.IncrementSortedFrom(strings.NewReader(input), parse); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	expected, _ := New([]int64{0, 10, 20})
+	for _, val := range []int64{-5, 0, 0, 9, 10, 25, 40} {
+		expected.Increment(val)
+	}
+	if !h.Equal(expected) {
+		t.Error("Expected", expected.BucketCounts(), "Got", h.BucketCounts())
+	}
+	upper, _ := New([]int64{0, 10, 20}, WithUpperClosed())
+	upper.IncrementSortedFrom(strings.NewReader(input), parse)
+	if counts := upper.BucketCounts(); !reflect.DeepEqual(counts, []int64{3, 2, 0, 2}) {
+		t.Error("Expected [3 2 0 2] Got", counts)
+	}
+	h.Clear()
+	if err := h.IncrementSortedFrom(strings.NewReader("5\n3\n"), parse); err == nil || h.Count() != 1 {
+		t.Error("Expected error after 1 sample Got", err, h.Count())
+	}
+	if err := h.IncrementSortedFrom(strings.NewReader("x\n"), parse); err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestModeValue(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	if _, ok := h.ModeValue(); ok {
+		t.Error("Expected not ok for empty histogram")
+	}
+	for val, count := range map[int64]int{25: 5, 35: 10, 45: 5} {
+		for i := 0; i < count; i++ {
+			h.Increment(val)
+		}
+	}
+	if mode, ok := h.ModeValue(); !ok || mode != 35 {
+		t.Error("Expected 35 Got", mode, ok)
+	}
+	for i := 0; i < 5; i++ {
+		h.Increment(45)
+	}
+	// Counts 5, 10, 10 put the vertex at the boundary between the tied buckets
+	if mode, _ := h.ModeValue(); mode != 40 {
+		t.Error("Expected 40 Got", mode)
+	}
+	h.Clear()
+	h.Increment(500)
+	if _, ok := h.ModeValue(); ok {
+		t.Error("Expected not ok for open ended peak")
+	}
+}
+
+func TestCDFPoints(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	if points := h.CDFPoints(); !reflect.DeepEqual(points, []CDFPoint{{0, 0}, {10, 0}, {20, 0}}) {
+		t.Error("Unexpected points", points)
+	}
+	h.Increment(-5)
+	h.Increment(5)
+	h.Increment(15)
+	h.Increment(15)
+	expected := []CDFPoint{{0, 0.25}, {10, 0.5}, {20, 1}}
+	if points := h.CDFPoints(); !reflect.DeepEqual(points, expected) {
+		t.Error("Expected", expected, "Got", points)
+	}
+	h.Increment(20)
+	if points := h.CDFPoints(); points[2].Fraction != 0.8 {
+		t.Error("Expected 0.8 Got", points[2].Fraction)
+	}
+}
+
+func TestSwapAndReset(t *testing.T) {
+	h, _ := New([]int64{10, 20}, WithUpperClosed(), WithCumulativeCounts())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := int64(0); j < 1000; j++ {
+				h.AtomicIncrement(j % 30)
+			}
+		}()
+	}
+	var count, bucketCount int64
+	for i := 0; i < 10; i++ {
+		swapped := h.SwapAndReset()
+		count += swapped.Count()
+		for _, c := range swapped.BucketCounts() {
+			bucketCount += c
+		}
+	}
+	wg.Wait()
+	swapped := h.SwapAndReset()
+	count += swapped.Count()
+	for _, c := range swapped.BucketCounts() {
+		bucketCount += c
+	}
+	if count != 4000 || bucketCount != 4000 || h.Count() != 0 {
+		t.Error("Expected 4000 samples swapped Got", count, bucketCount, "remaining", h.Count())
+	}
+	if index := swapped.BucketIndex(10); index != 0 {
+		t.Error("Expected options to be kept Got", index)
+	}
+	h.SetLabels([]string{"fast", "medium", "slow"})
+	if label := h.SwapAndReset().BucketLabel(2); label != "slow" {
+		t.Error("Expected labels to be kept Got", label)
+	}
+	// The live histogram must not keep cumulative counts from before the swap
+	h.Increment(5)
+	h.Increment(15)
+	h.Quantile(0.5)
+	h.SwapAndReset()
+	h.Increment(25)
+	if value, err := h.Quantile(0.5); err != nil || value != 20 {
+		t.Error("Expected 20 Got", value, err)
+	}
+}
+
+func TestCountBalancedBoundaries(t *testing.T) {
+	samples := []int64{100, 1, 2, 3, 4, 5, 5, 5, 6, 7, 1000, 50}
+	boundaries, err := CountBalancedBoundaries(samples, 3)
+	if err != nil || !reflect.DeepEqual(boundaries, []int64{4, 6}) {
+		t.Error("Expected [4 6] Got", boundaries, err)
+	}
+	h, _ := New(boundaries)
+	for _, sample := range samples {
+		h.Increment(sample)
+	}
+	for i, count := range h.BucketCounts() {
+		if count < 3 {
+			t.Error("Expected at least 3 samples in bucket", i, "Got", count)
+		}
+	}
+	if _, err := CountBalancedBoundaries(samples, 7); err == nil {
+		t.Error("Expected error for too few samples")
+	}
+	if _, err := CountBalancedBoundaries([]int64{5, 5, 5, 5}, 1); err == nil {
+		t.Error("Expected error for a single distinct value")
+	}
+	if _, err := CountBalancedBoundaries(samples, 0); err == nil {
+		t.Error("Expected error for minPerBucket 0")
+	}
+}
+
+func TestGini(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	if gini := h.Gini(); gini != 0 {
+		t.Error("Expected 0 Got", gini)
+	}
+	for i := 0; i < 10; i++ {
+		h.Increment(55)
+	}
+	if gini := h.Gini(); math.Abs(gini) > 1e-12 {
+		t.Error("Expected 0 Got", gini)
+	}
+	h.Clear()
+	// Three samples of 0 and one of 90 hold all the value in a quarter of the samples
+	for i := 0; i < 3; i++ {
+		h.Increment(0)
+	}
+	h.Increment(90)
+	if gini := h.Gini(); math.Abs(gini-0.75) > 1e-12 {
+		t.Error("Expected 0.75 Got", gini)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	h, _ := New([]int64{0, 100}, WithTopK(3))
+	for _, val := range []int64{5, 500, 50, 700, 5000, 200, 700} {
+		h.Increment(val)
+	}
+	h.AtomicIncrement(100000)
+	if top := h.TopK(); !reflect.DeepEqual(top, []int64{5000, 700, 700}) {
+		t.Error("Expected [5000 700 700] Got", top)
+	}
+	if top := h.Copy().TopK(); !reflect.DeepEqual(top, []int64{5000, 700, 700}) {
+		t.Error("Expected copy to keep the values Got", top)
+	}
+	h.Clear()
+	h.Increment(1)
+	if top := h.TopK(); !reflect.DeepEqual(top, []int64{1}) {
+		t.Error("Expected [1] Got", top)
+	}
+	plain, _ := New([]int64{0})
+	plain.Increment(5)
+	if top := plain.TopK(); len(top) != 0 {
+		t.Error("Expected no values Got", top)
+	}
+}
+
+func TestEstimateTotalsFromMidpoints(t *testing.T) {
+	h, _ := FromCounts([]int64{0, 10, 20}, []int64{1, 2, 3, 4}, []int64{-999, 7, 999, 1})
+	h.EstimateTotalsFromMidpoints()
+	if totals := h.BucketTotalsSnapshot(); !reflect.DeepEqual(totals, []int64{0, 10, 45, 80}) {
+		t.Error("Expected [0 10 45 80] Got", totals)
+	}
+	if h.Total() != 135 || h.BucketAverage(2) != 15 {
+		t.Error("Expected 135 15 Got", h.Total(), h.BucketAverage(2))
+	}
+}
+
+func TestLabeledHistogram(t *testing.T) {
+	l, err := NewLabeledHistogram([]int64{10, 20})
+	if err != nil {
+		t.Error("Unexpected error", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := int64(0); j < 100; j++ {
+				l.Observe([]string{"GET", "200"}, j%30)
+				l.Observe([]string{"POST", "500"}, 15)
+			}
+		}()
+	}
+	wg.Wait()
+	if h := l.Get([]string{"GET", "200"}); h == nil || h.Count() != 400 {
+		t.Error("Expected 400 samples Got", h)
+	}
+	if h := l.Get([]string{"POST", "500"}); h == nil || h.BucketCount(1) != 400 {
+		t.Error("Expected 400 samples in bucket 1 Got", h)
+	}
+	if h := l.Get([]string{"GET2", "00"}); h != nil {
+		t.Error("Expected nil Got", h)
+	}
+	if _, err := NewLabeledHistogram(nil); err == nil {
+		t.Error("Expected error for empty boundaries")
+	}
+}
+
+func TestLengthsConsistent(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	for i := int64(0); i < 100; i++ {
+		h.Increment(i)
+	}
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"AppendBoundary", func() error { return h.AppendBoundary(200) }},
+		{"PrependBoundary", func() error { return h.PrependBoundary(-50) }},
+		{"SplitBucket", func() error { return h.SplitBucket(3, 15) }},
+		{"MergeBucket", func() error { return h.MergeBucket(4) }},
+		{"Compact", func() error { h.Compact(); return nil }},
+		{"Repair", func() error { h.Repair(); return nil }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Error("Unexpected error in", step.name, err)
+		}
+		if !h.lengthsConsistent() {
+			t.Error("Expected consistent lengths after", step.name)
+		}
+	}
+	for _, derived := range []*Histogram{h.Copy(), h.Trim()} {
+		if !derived.lengthsConsistent() {
+			t.Error("Expected consistent lengths of derived histogram")
+		}
+	}
+	h.bucketTotals = h.bucketTotals[1:]
+	if h.lengthsConsistent() {
+		t.Error("Expected inconsistent lengths")
+	}
+}
+
+func TestOutliersSeparate(t *testing.T) {
+	h, _ := New([]int64{0, 10, 20})
+	h.Increment(5)
+	h.Increment(15)
+	h.Increment(-1000)
+	h.Increment(1000)
+	if h.BucketAverage(1) != 5 || h.BucketAverage(2) != 15 {
+		t.Error("Expected finite bucket averages 5 15 Got", h.BucketAverage(1), h.BucketAverage(2))
+	}
+	if h.UnderflowTotal() != -1000 || h.OverflowTotal() != 1000 {
+		t.Error("Expected outlier totals -1000 1000 Got", h.UnderflowTotal(), h.OverflowTotal())
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	h, _ := New([]int64{0, 10})
+	h.Increment(5)
+	h.Increment(5)
+	h.Increment(20)
+	var buf bytes.Buffer
+	if err := h.WriteSVG(&buf, 30, 10); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	svg := buf.String()
+	for _, expected := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="30" height="10" viewBox="0 0 30 10">`,
+		`<rect x="0.00" y="10.00" width="10.00" height="0.00" fill="#a0a0a0"><title>[-inf, 0) 0</title></rect>`,
+		`<rect x="10.00" y="0.00" width="10.00" height="10.00" fill="#4878d0"><title>[0, 10) 2</title></rect>`,
+		`<rect x="20.00" y="5.00" width="10.00" height="5.00" fill="#a0a0a0"><title>[10, +inf) 1</title></rect>`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Error("Expected", expected, "Got", svg)
+		}
+	}
+	if err := h.WriteSVG(&buf, 0, 10); err == nil {
+		t.Error("Expected error for zero width")
+	}
+}
+
+func TestTrackedHistogram(t *testing.T) {
+	tracked, _ := NewTrackedHistogram([]int64{10, 20})
+	a, _ := New([]int64{10, 20})
+	a.Increment(5)
+	a.Increment(15)
+	b, _ := New([]int64{10, 20})
+	b.Increment(25)
+	for _, step := range []struct {
+		name string
+		h    *Histogram
+	}{{"a", a}, {"b", b}, {"a", a}} {
+		if err := tracked.IncrementFromHistogram(step.name, step.h); err != nil {
+			t.Error("Unexpected error", err)
+		}
+	}
+	if contributions := tracked.Contributions(); !reflect.DeepEqual(contributions, map[string]int64{"a": 4, "b": 1}) {
+		t.Error("Expected map[a:4 b:1] Got", contributions)
+	}
+	if count := tracked.Histogram().Count(); count != 5 {
+		t.Error("Expected 5 Got", count)
+	}
+	other, _ := New([]int64{10, 30})
+	other.Increment(1)
+	if err := tracked.IncrementFromHistogram("c", other); err == nil || tracked.Histogram().Count() != 5 {
+		t.Error("Expected error without change Got", err, tracked.Histogram().Count())
+	}
+	if _, ok := tracked.Contributions()["c"]; ok {
+		t.Error("Expected no contribution from c")
+	}
+}
+
+func TestPeakToAverageRatio(t *testing.T) {
+	h, _ := New(Range(0, 100, 10))
+	if ratio := h.PeakToAverageRatio(); ratio != 0 {
+		t.Error("Expected 0 Got", ratio)
+	}
+	for i := 0; i < 9; i++ {
+		h.Increment(10)
+	}
+	h.Increment(90)
+	// Peak is the midpoint 95 of the highest bucket and the average is 18
+	if ratio := h.PeakToAverageRatio(); math.Abs(ratio-95.0/18) > 1e-12 {
+		t.Error("Expected", 95.0/18, "Got", ratio)
+	}
+	tracked, _ := New(Range(0, 100, 10), WithTopK(1))
+	for i := 0; i < 9; i++ {
+		tracked.Increment(10)
+	}
+	tracked.Increment(90)
+	if ratio := tracked.PeakToAverageRatio(); ratio != 5 {
+		t.Error("Expected 5 Got", ratio)
+	}
+}
+
+func TestQuantileCumulativeAtomic(t *testing.T) {
+	h, _ := New([]int64{10, 20, 30}, WithCumulativeCounts())
+	dest, _ := New([]int64{10, 20, 30}, WithCumulativeCounts())
+	// The number of samples is the same before the drain and after the increment
+	h.Increment(5)
+	h.Quantile(0.5)
+	h.DrainTo(dest)
+	h.AtomicIncrement(25)
+	if value, err := h.Quantile(0.5); err != nil || value != 25 {
+		t.Error("Expected 25 Got", value, err)
+	}
+	h.Clear()
+	h.Increment(5)
+	h.Quantile(0.5)
+	h.DrainTo(dest)
+	h.Increment(25)
+	if value, err := h.Quantile(0.5); err != nil || value != 25 {
+		t.Error("Expected 25 Got", value, err)
+	}
+	h.Clear()
+	dest.Quantile(0.5)
+	h.Increment(35)
+	h.DrainTo(dest)
+	if value, _ := dest.Quantile(1); value != 30 {
+		t.Error("Expected 30 Got", value)
+	}
+}
+
+func TestQuantileConcurrent(t *testing.T) {
+	h, _ := New(Range(0, 100, 10), WithCumulativeCounts())
+	for i := int64(0); i < 100; i++ {
+		h.Increment(i)
+	}
+	h.Scale(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if value, err := h.Quantile(0.5); err != nil || value != 50 {
+					t.Error("Expected 50 Got", value, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegistrySnapshotConcurrent(t *testing.T) {
+	r := NewRegistry()
+	h, _ := r.GetOrCreate("latency", []int64{10, 20})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(0); i < 1000; i++ {
+			h.AtomicIncrement(i % 30)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if snapshot := r.Snapshot()["latency"]; snapshot.Count() > 1000 {
+			t.Error("Expected at most 1000 samples Got", snapshot.Count())
+		}
+	}
+	<-done
+	if count := r.Snapshot()["latency"].Count(); count != 1000 {
+		t.Error("Expected 1000 Got", count)
+	}
+}
+
+func TestTopKShiftConvert(t *testing.T) {
+	h, _ := New([]int64{0, 1000}, WithTopK(2))
+	for _, val := range []int64{10, 500, 900} {
+		h.Increment(val)
+	}
+	shifted, _ := h.Shift(100)
+	if top := shifted.TopK(); !reflect.DeepEqual(top, []int64{1000, 600}) {
+		t.Error("Expected [1000 600] Got", top)
+	}
+	converted, _ := h.ConvertUnits(100)
+	if top := converted.TopK(); !reflect.DeepEqual(top, []int64{9, 5}) {
+		t.Error("Expected [9 5] Got", top)
+	}
+}
+
+func TestDistinctShiftConvert(t *testing.T) {
+	h, _ := New([]int64{0, 1000}, WithDistinctCount())
+	for _, val := range []int64{10, 20, 110} {
+		h.Increment(val)
+	}
+	shifted, _ := h.Shift(100)
+	if _, ok := shifted.distinctValues[1][110]; !ok || shifted.BucketDistinct(1) != 3 {
+		t.Error("Expected shifted distinct values Got", shifted.distinctValues[1])
+	}
+	if _, ok := h.distinctValues[1][10]; !ok {
+		t.Error("Expected original distinct values to be unchanged")
+	}
+	// 10 and 20 both become 0
+	converted, _ := h.ConvertUnits(100)
+	if distinct := converted.BucketDistinct(1); distinct != 2 {
+		t.Error("Expected 2 Got", distinct)
+	}
+}
+
+func TestUnmarshalResetsRetainedSamples(t *testing.T) {
+	source, _ := New([]int64{10, 20})
+	source.Increment(100)
+	text, _ := source.MarshalText()
+	sparse, _ := source.MarshalSparse()
+	for name, unmarshal := range map[string]func(h *Histogram) error{
+		"text":   func(h *Histogram) error { return h.UnmarshalText(text) },
+		"sparse": func(h *Histogram) error { return h.UnmarshalSparse(sparse) },
+	} {
+		h, _ := New([]int64{10, 20}, WithReservoir(4), WithTopK(2))
+		h.Increment(15)
+		if err := unmarshal(h); err != nil {
+			t.Error("Unexpected error in", name, err)
+		}
+		if value, exact := h.ExactQuantile(0.5); exact || value != 20 {
+			t.Error("Expected inexact 20 after", name, "Got", value, exact)
+		}
+		if top := h.TopK(); len(top) != 0 {
+			t.Error("Expected no top values after", name, "Got", top)
+		}
+	}
+}
+
+func TestUpperClosedMismatch(t *testing.T) {
+	lower, _ := New([]int64{10, 20})
+	upper, _ := New([]int64{10, 20}, WithUpperClosed())
+	lower.Increment(10)
+	upper.Increment(10)
+	if lower.Equal(upper) {
+		t.Error("Expected histograms with different conventions to differ")
+	}
+	if err := upper.MergeInto(lower); err == nil {
+		t.Error("Expected error merging different conventions")
+	}
+	if err := upper.DrainTo(lower); err == nil {
+		t.Error("Expected error draining into a different convention")
+	}
+	if _, err := Combine(lower, upper); err == nil {
+		t.Error("Expected error combining different conventions")
+	}
+	if err := upper.FoldInto(lower); err == nil {
+		t.Error("Expected error folding into a different convention")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic merging different conventions")
+			}
+		}()
+		lower.Merge(upper)
+	}()
+	if lower.Count() != 1 || upper.Count() != 1 {
+		t.Error("Expected histograms to be unchanged")
+	}
+}
+
+func TestUpperClosedEncoding(t *testing.T) {
+	h, _ := New([]int64{10}, WithUpperClosed())
+	h.Increment(10)
+	if s := fmt.Sprintf("%+v", h); !strings.HasPrefix(s, "(-inf, 10] count=1") {
+		t.Error("Expected upper-closed range Got", s)
+	}
+	var buf bytes.Buffer
+	if err := h.WriteSVG(&buf, 100, 100); err != nil || !strings.Contains(buf.String(), "<title>(10, +inf] 0</title>") {
+		t.Error("Expected upper-closed range in SVG Got", buf.String(), err)
+	}
+	if err := h.WriteCSV(&buf); err == nil {
+		t.Error("Expected error writing CSV")
+	}
+	if _, err := h.MarshalText(); err == nil {
+		t.Error("Expected error marshalling text")
+	}
+	if _, err := h.MarshalJSON(); err == nil {
+		t.Error("Expected error marshalling JSON")
+	}
+	if _, err := json.Marshal(CumulativeJSON{h}); err == nil {
+		t.Error("Expected error marshalling cumulative JSON")
+	}
+	if _, err := h.MarshalSparse(); err == nil {
+		t.Error("Expected error marshalling sparse")
+	}
+	if _, err := h.MarshalMsgpack(); err == nil {
+		t.Error("Expected error marshalling MessagePack")
+	}
+}
@@ -0,0 +1,162 @@
+package histogram
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// jsonHistogram is the per-bucket JSON representation of a histogram
+type jsonHistogram struct {
+	Boundaries []int64 `json:"boundaries"`
+	Counts     []int64 `json:"counts"`
+	Totals     []int64 `json:"totals"`
+}
+
+// jsonBucket is a single cumulative bucket, le is the upper boundary or "+Inf"
+type jsonBucket struct {
+	Le    string `json:"le"`
+	Count int64  `json:"count"`
+	Total int64  `json:"total"`
+}
+
+// CumulativeJSON wraps a histogram to marshal cumulative buckets with le keys.
+// Each bucket holds the count and total of all samples less than le.
+// json.Marshal(CumulativeJSON{h}) emits {"buckets":[{"le":"1","count":0,"total":0},...,{"le":"+Inf",...}]}
+type CumulativeJSON struct {
+	*Histogram
+}
+
+// MarshalJSON method encodes the histogram with per-bucket counts and totals
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	if h.upperClosed {
+		return nil, upperClosedError
+	}
+	return json.Marshal(jsonHistogram{
+		Boundaries: h.bucketBoundaries,
+		Counts:     h.bucketCounts,
+		Totals:     h.bucketTotals,
+	})
+}
+
+// UnmarshalJSON method decodes the format produced by MarshalJSON into the histogram
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var j jsonHistogram
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	return h.setBuckets(j.Boundaries, j.Counts, j.Totals)
+}
+
+// UnmarshalJSONStrict decodes the format produced by MarshalJSON from untrusted input.
+// Besides the checks of UnmarshalJSON it rejects unknown fields, trailing data, negative
+// bucket counts, and bucket totals whose average does not lie within the bucket.
+func UnmarshalJSONStrict(data []byte) (*Histogram, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var j jsonHistogram
+	if err := decoder.Decode(&j); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, invalidFormatError
+	}
+	h := &Histogram{}
+	if err := h.setBuckets(j.Boundaries, j.Counts, j.Totals); err != nil {
+		return nil, err
+	}
+	for i, count := range h.bucketCounts {
+		if count < 0 {
+			return nil, negativeCountError
+		}
+		low, high := h.BucketRanges(i)
+		total := float64(h.bucketTotals[i])
+		// Every sample lies in [low, high), so the total lies in [count * low, count * (high - 1)]
+		if total < float64(count)*float64(low) || total > float64(count)*float64(high-1) {
+			return nil, inconsistentTotalError
+		}
+	}
+	return h, nil
+}
+
+// MarshalJSON method encodes the histogram with cumulative counts and totals
+func (c CumulativeJSON) MarshalJSON() ([]byte, error) {
+	h := c.Histogram
+	if h.upperClosed {
+		return nil, upperClosedError
+	}
+	buckets := make([]jsonBucket, len(h.bucketCounts))
+	var count, total int64
+	for i := range h.bucketCounts {
+		count += h.bucketCounts[i]
+		total += h.bucketTotals[i]
+		le := "+Inf"
+		if i < len(h.bucketBoundaries) {
+			le = strconv.FormatInt(h.bucketBoundaries[i], 10)
+		}
+		buckets[i] = jsonBucket{Le: le, Count: count, Total: total}
+	}
+	return json.Marshal(struct {
+		Buckets []jsonBucket `json:"buckets"`
+	}{buckets})
+}
+
+// UnmarshalJSON method decodes cumulative buckets back into per-bucket counts and totals.
+// The last bucket must have le "+Inf".
+func (c *CumulativeJSON) UnmarshalJSON(data []byte) error {
+	var j struct {
+		Buckets []jsonBucket `json:"buckets"`
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if len(j.Buckets) < 2 || j.Buckets[len(j.Buckets)-1].Le != "+Inf" {
+		return invalidFormatError
+	}
+	bucketBoundaries := make([]int64, len(j.Buckets)-1)
+	bucketCounts := make([]int64, len(j.Buckets))
+	bucketTotals := make([]int64, len(j.Buckets))
+	var count, total int64
+	for i, bucket := range j.Buckets {
+		if i < len(bucketBoundaries) {
+			boundary, err := strconv.ParseInt(bucket.Le, 10, 64)
+			if err != nil {
+				return invalidFormatError
+			}
+			bucketBoundaries[i] = boundary
+		}
+		bucketCounts[i] = bucket.Count - count
+		bucketTotals[i] = bucket.Total - total
+		count, total = bucket.Count, bucket.Total
+	}
+	if c.Histogram == nil {
+		c.Histogram = &Histogram{}
+	}
+	return c.Histogram.setBuckets(bucketBoundaries, bucketCounts, bucketTotals)
+}
+
+// WriteHeatmapFrame method writes the histogram as a single row of a heatmap data frame in the
+// bucket layout of Grafana, a JSON object with the timestamp in milliseconds since the epoch under
+// "time", followed by the count of each bucket under its upper boundary in increasing order.
+// The last bucket is named "+Inf", and counts are per bucket rather than cumulative.
+// For example {"time":1700000000000,"10":1,"20":0,"+Inf":2} followed by a newline.
+func (h *Histogram) WriteHeatmapFrame(w io.Writer, timestamp time.Time) error {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	buf.WriteString(strconv.FormatInt(timestamp.UnixMilli(), 10))
+	for i, count := range h.bucketCounts {
+		le := "+Inf"
+		if i < len(h.bucketBoundaries) {
+			le = strconv.FormatInt(h.bucketBoundaries[i], 10)
+		}
+		buf.WriteString(`,"`)
+		buf.WriteString(le)
+		buf.WriteString(`":`)
+		buf.WriteString(strconv.FormatInt(count, 10))
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,63 @@
+package histogram
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LabeledHistogram holds a histogram per set of label values, like a labeled Prometheus histogram.
+// Histograms are created on the first observation of their label values from a Template, so they
+// share bucket boundaries and options and can be merged with each other.
+// Observe and Get are thread-safe.
+type LabeledHistogram struct {
+	template   *Template
+	mu         sync.RWMutex
+	histograms map[string]*Histogram
+}
+
+func NewLabeledHistogram(bucketBoundaries []int64, opts ...Option) (*LabeledHistogram, error) {
+	template, err := NewTemplate(bucketBoundaries, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &LabeledHistogram{template: template, histograms: make(map[string]*Histogram)}, nil
+}
+
+// Observe method inserts a sample into the histogram of the label values with AtomicIncrement,
+// creating the histogram if needed
+func (l *LabeledHistogram) Observe(labels []string, val int64) {
+	key := labelsKey(labels)
+	l.mu.RLock()
+	h, ok := l.histograms[key]
+	l.mu.RUnlock()
+	if !ok {
+		l.mu.Lock()
+		if h, ok = l.histograms[key]; !ok {
+			h = l.template.New()
+			l.histograms[key] = h
+		}
+		l.mu.Unlock()
+	}
+	h.AtomicIncrement(val)
+}
+
+// Get method returns the histogram of the label values, or nil if nothing was observed with them.
+// The histogram is updated in place by Observe, so it must be read with atomic methods
+// while Observe may be called concurrently.
+func (l *LabeledHistogram) Get(labels []string) *Histogram {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.histograms[labelsKey(labels)]
+}
+
+// labelsKey encodes label values with length prefixes, so that distinct label values never share a key
+func labelsKey(labels []string) string {
+	var b strings.Builder
+	for _, label := range labels {
+		b.WriteString(strconv.Itoa(len(label)))
+		b.WriteByte(':')
+		b.WriteString(label)
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package histogram
+
+import "math"
+
+// MergeReport describes how much of a merge was approximated
+type MergeReport struct {
+	// Redistributed is the number of samples of buckets which did not fit within a single
+	// bucket of the result and were split in proportion to the overlapping ranges.
+	// It is 0 when the bucket boundaries are aligned.
+	Redistributed int64
+	// Residual is the number of redistributed samples lost to rounding the split counts towards zero,
+	// so the merged number of samples is the sum of both numbers of samples minus Residual.
+	Residual int64
+	// TotalResidual is the part of the totals of redistributed samples lost to rounding,
+	// so the merged total is the sum of both totals minus TotalResidual.
+	TotalResidual int64
+}
+
+// Merge method returns a new histogram with the bucket boundaries of this histogram holding
+// the samples of both histograms. See MergeWithReport.
+func (h *Histogram) Merge(other *Histogram) *Histogram {
+	merged, _ := h.MergeWithReport(other)
+	return merged
+}
+
+// MergeWithReport method returns a new histogram with the bucket boundaries of this histogram
+// holding the samples of both histograms, and a report of the redistributed samples and the
+// residual lost to rounding.
+// Each bucket of other which lies within a single bucket is added exactly. Other finite buckets
+// are split in proportion to their overlap with each bucket, rounding the counts and totals
+// towards zero. Samples of the open ended buckets of other are treated as lying at their finite
+// boundary. Number of samples and total of the result are the sums of its buckets.
+// Both histograms must have the same WithUpperClosed option.
+func (h *Histogram) MergeWithReport(other *Histogram) (*Histogram, MergeReport) {
+	if h.upperClosed != other.upperClosed {
+		panic("Mismatch in bucket closedness")
+	}
+	var report MergeReport
+	merged := h.Copy()
+	last := len(other.bucketBoundaries)
+	for j := range other.bucketCounts {
+		count, total := other.bucketCounts[j], other.bucketTotals[j]
+		if count == 0 && total == 0 {
+			continue
+		}
+		low, high := other.BucketRanges(j)
+		if j == 0 || j == last {
+			// Open ended bucket is aligned only if it falls in the matching open ended bucket
+			target := bucketIndex(merged.bucketBoundaries, high-1)
+			if j == last {
+				target = bucketIndex(merged.bucketBoundaries, low)
+			}
+			if (j == 0 && target != 0) || (j == last && target != len(merged.bucketBoundaries)) {
+				report.Redistributed += count
+			}
+			merged.bucketCounts[target] += count
+			merged.bucketTotals[target] += total
+			continue
+		}
+		first, end := bucketIndex(merged.bucketBoundaries, low), bucketIndex(merged.bucketBoundaries, high-1)
+		if first == end {
+			merged.bucketCounts[first] += count
+			merged.bucketTotals[first] += total
+			continue
+		}
+		report.Redistributed += count
+		report.Residual += count
+		report.TotalResidual += total
+		for i := first; i <= end; i++ {
+			bucketLow, bucketHigh := merged.BucketRanges(i)
+			fraction := float64(minInt64(high, bucketHigh)-maxInt64(low, bucketLow)) / float64(high-low)
+			portion := int64(math.Trunc(float64(count) * fraction))
+			totalPortion := int64(math.Trunc(float64(total) * fraction))
+			merged.bucketCounts[i] += portion
+			merged.bucketTotals[i] += totalPortion
+			report.Residual -= portion
+			report.TotalResidual -= totalPortion
+		}
+	}
+	merged.numSamples = 0
+	merged.total = 0
+	for i := range merged.bucketCounts {
+		merged.numSamples += merged.bucketCounts[i]
+		merged.total += merged.bucketTotals[i]
+	}
+	merged.sumOfSquares += other.sumOfSquares
+	return merged, report
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// MergeWithWeights returns a new histogram holding the samples of every histogram repeated
+// weight times, like calling IncrementFromHistogram weight times for each of them.
+// All histograms must have identical bucket boundaries and weights must not be negative.
+func MergeWithWeights(hists []*Histogram, weights []int64) (*Histogram, error) {
+	if len(hists) == 0 {
+		return nil, emptyError
+	}
+	if len(hists) != len(weights) {
+		return nil, invalidLengthsError
+	}
+	for i, other := range hists {
+		if !hists[0].sameBoundaries(other) {
+			return nil, mismatchError
+		}
+		if weights[i] < 0 {
+			return nil, invalidArgumentError
+		}
+	}
+	merged := hists[0].Copy()
+	merged.Clear()
+	for i, other := range hists {
+		weight := weights[i]
+		for j := range merged.bucketCounts {
+			merged.bucketCounts[j] += other.bucketCounts[j] * weight
+			merged.bucketTotals[j] += other.bucketTotals[j] * weight
+		}
+		merged.numSamples += other.numSamples * weight
+		merged.total += other.total * weight
+		merged.sumOfSquares += other.sumOfSquares * weight
+	}
+	return merged, nil
+}
+
+// Combine returns a new histogram holding the samples of both histograms, treating nil as
+// the empty histogram so that it can start a reduction. If one of them is nil a copy of the
+// other is returned, and if both are nil the result is nil. Otherwise both must have identical
+// bucket boundaries.
+func Combine(a, b *Histogram) (*Histogram, error) {
+	if a == nil && b == nil {
+		return nil, nil
+	} else if a == nil {
+		return b.Copy(), nil
+	} else if b == nil {
+		return a.Copy(), nil
+	}
+	if !a.sameBoundaries(b) {
+		return nil, mismatchError
+	}
+	combined := a.Copy()
+	combined.IncrementFromHistogram(b)
+	return combined, nil
+}
@@ -0,0 +1,166 @@
+package histogram
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// MarshalMsgpack method encodes the histogram as a MessagePack map with the keys
+// boundaries, counts and totals holding arrays of integers, like MarshalJSON.
+func (h *Histogram) MarshalMsgpack() ([]byte, error) {
+	if h.upperClosed {
+		return nil, upperClosedError
+	}
+	buf := []byte{0x83}
+	for _, field := range []struct {
+		key    string
+		values []int64
+	}{
+		{"boundaries", h.bucketBoundaries},
+		{"counts", h.bucketCounts},
+		{"totals", h.bucketTotals},
+	} {
+		buf = append(buf, 0xa0|byte(len(field.key)))
+		buf = append(buf, field.key...)
+		buf = appendMsgpackArray(buf, len(field.values))
+		for _, value := range field.values {
+			buf = appendMsgpackInt(buf, value)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalMsgpack method decodes the format produced by MarshalMsgpack into the histogram
+// with the same validation as UnmarshalJSON
+func (h *Histogram) UnmarshalMsgpack(data []byte) error {
+	d := msgpackDecoder{data: data}
+	size := d.mapHeader()
+	fields := make(map[string][]int64)
+	for i := 0; i < size && d.err == nil; i++ {
+		key := d.str()
+		length := d.arrayHeader()
+		if length > len(d.data) {
+			// Every element takes at least one byte
+			return invalidFormatError
+		}
+		values := make([]int64, length)
+		for j := range values {
+			values[j] = d.int()
+		}
+		fields[key] = values
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return invalidFormatError
+	}
+	return h.setBuckets(fields["boundaries"], fields["counts"], fields["totals"])
+}
+
+// appendMsgpackArray appends an array header of length n
+func appendMsgpackArray(buf []byte, n int) []byte {
+	if n < 16 {
+		return append(buf, 0x90|byte(n))
+	} else if n <= math.MaxUint16 {
+		return binary.BigEndian.AppendUint16(append(buf, 0xdc), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, 0xdd), uint32(n))
+}
+
+// appendMsgpackInt appends value in the smallest integer format
+func appendMsgpackInt(buf []byte, value int64) []byte {
+	switch {
+	case value >= 0 && value <= math.MaxInt8:
+		return append(buf, byte(value))
+	case value >= -32 && value < 0:
+		return append(buf, byte(value))
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		return append(buf, 0xd0, byte(value))
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(value))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(value))
+}
+
+// msgpackDecoder reads MessagePack values from data, the first error is kept in err
+type msgpackDecoder struct {
+	data []byte
+	err  error
+}
+
+// next returns the next n bytes
+func (d *msgpackDecoder) next(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = invalidFormatError
+		return make([]byte, n)
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *msgpackDecoder) mapHeader() int {
+	switch b := d.next(1)[0]; {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f)
+	case b == 0xde:
+		return int(binary.BigEndian.Uint16(d.next(2)))
+	}
+	d.err = invalidFormatError
+	return 0
+}
+
+func (d *msgpackDecoder) arrayHeader() int {
+	switch b := d.next(1)[0]; {
+	case b&0xf0 == 0x90:
+		return int(b & 0x0f)
+	case b == 0xdc:
+		return int(binary.BigEndian.Uint16(d.next(2)))
+	case b == 0xdd:
+		return int(binary.BigEndian.Uint32(d.next(4)))
+	}
+	d.err = invalidFormatError
+	return 0
+}
+
+func (d *msgpackDecoder) str() string {
+	switch b := d.next(1)[0]; {
+	case b&0xe0 == 0xa0:
+		return string(d.next(int(b & 0x1f)))
+	case b == 0xd9:
+		return string(d.next(int(d.next(1)[0])))
+	}
+	d.err = invalidFormatError
+	return ""
+}
+
+func (d *msgpackDecoder) int() int64 {
+	switch b := d.next(1)[0]; {
+	case b <= 0x7f:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b == 0xcc:
+		return int64(d.next(1)[0])
+	case b == 0xcd:
+		return int64(binary.BigEndian.Uint16(d.next(2)))
+	case b == 0xce:
+		return int64(binary.BigEndian.Uint32(d.next(4)))
+	case b == 0xcf:
+		value := binary.BigEndian.Uint64(d.next(8))
+		if value > math.MaxInt64 {
+			d.err = overflowError
+		}
+		return int64(value)
+	case b == 0xd0:
+		return int64(int8(d.next(1)[0]))
+	case b == 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(d.next(2))))
+	case b == 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(d.next(4))))
+	case b == 0xd3:
+		return int64(binary.BigEndian.Uint64(d.next(8)))
+	}
+	d.err = invalidFormatError
+	return 0
+}
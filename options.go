@@ -0,0 +1,25 @@
+package histogram
+
+// Option configures optional behavior of a histogram created with New
+type Option func(h *Histogram)
+
+// WithClampValues option makes Increment and AtomicIncrement clamp values to
+// [bucketBoundaries[0], bucketBoundaries[last]] like IncrementClamped.
+// Totals then hold the clamped values instead of the raw values.
+func WithClampValues() Option {
+	return func(h *Histogram) {
+		h.clampValues = true
+	}
+}
+
+// WithUpperClosed option makes buckets upper-closed, so bucket[i] holds values in
+// (bucketBoundaries[i-1], bucketBoundaries[i]] and a value equal to a boundary falls into the
+// lower bucket. It affects Increment, AtomicIncrement and BucketIndex, while BucketRanges and
+// the estimations from bucket boundaries are unchanged. Histograms with and without it are
+// not merged with each other, as if their bucket boundaries differed. The marshal methods and
+// WriteCSV do not encode the option, so they return an error for upper-closed histograms.
+func WithUpperClosed() Option {
+	return func(h *Histogram) {
+		h.upperClosed = true
+	}
+}
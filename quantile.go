@@ -0,0 +1,291 @@
+package histogram
+
+import "math"
+
+// Quantile method estimates the value below which q fraction of the samples fall.
+// q must belong to [0, 1]. The value is linearly interpolated within the bucket it
+// falls in, and the finite boundary is returned for the open ended first and last buckets.
+// The bucket is found in O(buckets), or in O(log buckets) with WithCumulativeCounts.
+func (h *Histogram) Quantile(q float64) (int64, error) {
+	return QuantileOf(q, h)
+}
+
+// QuantileOf estimates the quantile of the combined samples of all the histograms
+// without merging them. All histograms must have identical bucket boundaries.
+func QuantileOf(q float64, hists ...*Histogram) (int64, error) {
+	index, fraction, err := quantileBucket(q, hists)
+	if err != nil {
+		return 0, err
+	}
+	return hists[0].interpolate(index, fraction), nil
+}
+
+// QuantileError method returns the worst case error of Quantile(q), which is the width
+// of the bucket the quantile falls in. It is math.MaxInt64 if the quantile falls in the
+// open ended first or last bucket, and 0 if the quantile cannot be estimated.
+func (h *Histogram) QuantileError(q float64) int64 {
+	index, _, err := quantileBucket(q, []*Histogram{h})
+	if err != nil {
+		return 0
+	}
+	if index == 0 || index == len(h.bucketBoundaries) {
+		return math.MaxInt64
+	}
+	low, high := h.BucketRanges(index)
+	return high - low
+}
+
+// quantileBucket returns the index of the bucket the quantile of the combined samples
+// falls in, and the fraction of the bucket below the quantile
+func quantileBucket(q float64, hists []*Histogram) (int, float64, error) {
+	if len(hists) == 0 {
+		return 0, 0, emptyError
+	}
+	h := hists[0]
+	var numSamples int64
+	for _, other := range hists {
+		if !h.sameBoundaries(other) {
+			return 0, 0, mismatchError
+		}
+		numSamples += other.numSamples
+	}
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return 0, 0, invalidQuantileError
+	}
+	if numSamples <= 0 {
+		return 0, 0, noSamplesError
+	}
+	rank := q * float64(numSamples)
+	if len(hists) == 1 && h.cumulativeUsable() {
+		index, fraction := h.searchCumulative(rank)
+		return index, fraction, nil
+	}
+	var cumulative int64
+	last := 0
+	for i := range h.bucketCounts {
+		var count int64
+		for _, other := range hists {
+			count += other.bucketCounts[i]
+		}
+		if count <= 0 {
+			continue
+		}
+		if float64(cumulative+count) >= rank {
+			return i, (rank - float64(cumulative)) / float64(count), nil
+		}
+		cumulative += count
+		last = i
+	}
+	// Bucket counts add up to less than number of samples, return the highest non-empty bucket
+	return last, 1, nil
+}
+
+// interpolate method returns the value at fraction of the range of the bucket.
+// The finite boundary is returned for the open ended first and last buckets.
+func (h *Histogram) interpolate(index int, fraction float64) int64 {
+	low, high := h.BucketRanges(index)
+	if index == 0 {
+		return high
+	} else if index == len(h.bucketBoundaries) {
+		return low
+	}
+	return low + int64(math.Round(fraction*float64(high-low)))
+}
+
+// CountInRange method estimates the number of samples in the half-open range [low, high).
+// Counts are linearly interpolated within partially covered buckets, samples in the
+// open ended first and last buckets are treated as lying at their finite boundary.
+func (h *Histogram) CountInRange(low, high int64) int64 {
+	if low >= high {
+		return 0
+	}
+	return int64(math.Round(h.countLess(high) - h.countLess(low)))
+}
+
+// CountBelow method estimates the number of samples less than threshold
+func (h *Histogram) CountBelow(threshold int64) int64 {
+	return int64(math.Round(h.countLess(threshold)))
+}
+
+// CountAbove method estimates the number of samples greater than threshold
+func (h *Histogram) CountAbove(threshold int64) int64 {
+	if threshold == math.MaxInt64 {
+		return 0
+	}
+	return int64(math.Round(float64(h.numSamples) - h.countLess(threshold+1)))
+}
+
+// countLess method estimates the number of samples less than val
+func (h *Histogram) countLess(val int64) float64 {
+	index := bucketIndex(h.bucketBoundaries, val)
+	var cumulative int64
+	for i := 0; i < index; i++ {
+		cumulative += h.bucketCounts[i]
+	}
+	if index == 0 {
+		return float64(cumulative)
+	} else if index == len(h.bucketBoundaries) {
+		if val > h.bucketBoundaries[index-1] {
+			cumulative += h.bucketCounts[index]
+		}
+		return float64(cumulative)
+	}
+	low, high := h.BucketRanges(index)
+	return float64(cumulative) + float64(h.bucketCounts[index])*float64(val-low)/float64(high-low)
+}
+
+// BucketPercentileRange method returns the percentage of samples below this bucket and the
+// percentage of samples up to and including this bucket. Both are 0 if the histogram is empty.
+func (h *Histogram) BucketPercentileRange(index int) (lowPct, highPct float64) {
+	if h.IsEmpty() {
+		return 0, 0
+	}
+	var below int64
+	for i := 0; i < index; i++ {
+		below += h.bucketCounts[i]
+	}
+	lowPct = 100 * float64(below) / float64(h.numSamples)
+	highPct = 100 * float64(below+h.bucketCounts[index]) / float64(h.numSamples)
+	return lowPct, highPct
+}
+
+// BoundaryPercentiles method returns the percentage of samples below each bucket boundary.
+// All percentages are 0 if the histogram is empty.
+func (h *Histogram) BoundaryPercentiles() []float64 {
+	percentiles := make([]float64, len(h.bucketBoundaries))
+	if h.IsEmpty() {
+		return percentiles
+	}
+	var below int64
+	for i := range h.bucketBoundaries {
+		below += h.bucketCounts[i]
+		percentiles[i] = 100 * float64(below) / float64(h.numSamples)
+	}
+	return percentiles
+}
+
+// ValueWeightedQuantile method estimates the value below which q fraction of the total of all
+// samples falls, using the bucket totals instead of the bucket counts. Buckets with negative
+// totals are skipped, and an error is returned if the total of the histogram is not positive.
+func (h *Histogram) ValueWeightedQuantile(q float64) (int64, error) {
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return 0, invalidQuantileError
+	}
+	var sum int64
+	for _, total := range h.bucketTotals {
+		if total > 0 {
+			sum += total
+		}
+	}
+	if sum <= 0 {
+		return 0, noSamplesError
+	}
+	rank := q * float64(sum)
+	var cumulative int64
+	for i, total := range h.bucketTotals {
+		if total <= 0 {
+			continue
+		}
+		if float64(cumulative+total) >= rank {
+			return h.interpolate(i, (rank-float64(cumulative))/float64(total)), nil
+		}
+		cumulative += total
+	}
+	return h.bucketBoundaries[len(h.bucketBoundaries)-1], nil
+}
+
+// CountBetweenPercentiles method returns the number of samples between the lowPct and highPct
+// percentiles, which is (highPct - lowPct) percent of the samples rounded to the nearest integer.
+// It is 0 unless 0 <= lowPct < highPct <= 100.
+func (h *Histogram) CountBetweenPercentiles(lowPct, highPct float64) int64 {
+	if !(lowPct >= 0 && lowPct < highPct && highPct <= 100) || h.IsEmpty() {
+		return 0
+	}
+	// Percentiles are ranks among the samples, so the count follows from the ranks alone
+	low := math.Round(lowPct / 100 * float64(h.numSamples))
+	high := math.Round(highPct / 100 * float64(h.numSamples))
+	return int64(high - low)
+}
+
+// TotalBetweenPercentiles method returns the sum of the samples between the lowPct and highPct
+// percentiles, the value weighted analog of CountBetweenPercentiles. Buckets wholly within the band
+// contribute their totals, and a bucket partially within the band contributes its total in
+// proportion to the fraction of its samples within the band. lowPct and highPct must satisfy
+// 0 <= lowPct <= highPct <= 100.
+func (h *Histogram) TotalBetweenPercentiles(lowPct, highPct float64) (int64, error) {
+	if !(lowPct >= 0 && lowPct <= highPct && highPct <= 100) {
+		return 0, invalidQuantileError
+	}
+	if h.IsEmpty() {
+		return 0, noSamplesError
+	}
+	low := lowPct / 100 * float64(h.numSamples)
+	high := highPct / 100 * float64(h.numSamples)
+	var cumulative, total float64
+	for i, count := range h.bucketCounts {
+		if count <= 0 {
+			continue
+		}
+		start, end := cumulative, cumulative+float64(count)
+		cumulative = end
+		if overlap := math.Min(end, high) - math.Max(start, low); overlap > 0 {
+			total += float64(h.bucketTotals[i]) * overlap / float64(count)
+		}
+	}
+	return int64(math.Round(total)), nil
+}
+
+// SurvivalFunction method returns the estimated fraction of samples strictly greater than val,
+// with the same interpolation as CountAbove. It sums the buckets above val directly instead of
+// subtracting from the cumulative distribution, so small fractions in the far tail keep their
+// precision. It returns 0 if the histogram is empty.
+func (h *Histogram) SurvivalFunction(val int64) float64 {
+	if h.IsEmpty() || val == math.MaxInt64 {
+		return 0
+	}
+	return h.countAtLeast(val+1) / float64(h.numSamples)
+}
+
+// countAtLeast method estimates the number of samples greater than or equal to val,
+// the complement of countLess
+func (h *Histogram) countAtLeast(val int64) float64 {
+	index := bucketIndex(h.bucketBoundaries, val)
+	var cumulative int64
+	for i := len(h.bucketCounts) - 1; i > index; i-- {
+		cumulative += h.bucketCounts[i]
+	}
+	if index == 0 {
+		return float64(cumulative + h.bucketCounts[0])
+	} else if index == len(h.bucketBoundaries) {
+		if val == h.bucketBoundaries[index-1] {
+			cumulative += h.bucketCounts[index]
+		}
+		return float64(cumulative)
+	}
+	low, high := h.BucketRanges(index)
+	return float64(cumulative) + float64(h.bucketCounts[index])*float64(high-val)/float64(high-low)
+}
+
+// CDFPoint is a step of the cumulative distribution, the fraction of samples less than Value
+type CDFPoint struct {
+	Value    int64
+	Fraction float64
+}
+
+// CDFPoints method returns the cumulative distribution at each bucket boundary, which is the
+// fraction of samples in the buckets below the boundary. Samples of the open ended first bucket
+// are included from the first point, and the last point reaches 1 only if the open ended last
+// bucket is empty. With WithUpperClosed the fractions include the samples equal to the boundary.
+// Fractions are all zero if the histogram is empty.
+func (h *Histogram) CDFPoints() []CDFPoint {
+	points := make([]CDFPoint, len(h.bucketBoundaries))
+	var cumulative int64
+	for i, boundary := range h.bucketBoundaries {
+		cumulative += h.bucketCounts[i]
+		points[i].Value = boundary
+		if !h.IsEmpty() {
+			points[i].Fraction = float64(cumulative) / float64(h.numSamples)
+		}
+	}
+	return points
+}
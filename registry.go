@@ -0,0 +1,46 @@
+package histogram
+
+import "sync"
+
+// Registry holds histograms by name.
+// All methods are thread-safe.
+type Registry struct {
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+func NewRegistry() *Registry {
+	return &Registry{histograms: make(map[string]*Histogram)}
+}
+
+// GetOrCreate method returns the histogram registered with name, creating it with
+// bucketBoundaries if it does not exist. An error is returned if the existing histogram
+// has different bucket boundaries.
+func (r *Registry) GetOrCreate(name string, bucketBoundaries []int64) (*Histogram, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[name]; ok {
+		if !equalBoundaries(h.bucketBoundaries, bucketBoundaries) {
+			return nil, mismatchError
+		}
+		return h, nil
+	}
+	h, err := New(bucketBoundaries)
+	if err != nil {
+		return nil, err
+	}
+	r.histograms[name] = h
+	return h, nil
+}
+
+// Snapshot method returns copies of all registered histograms by name.
+// Histograms are read atomically, so they may be updated concurrently with AtomicIncrement.
+func (r *Registry) Snapshot() map[string]*Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := make(map[string]*Histogram, len(r.histograms))
+	for name, h := range r.histograms {
+		snapshot[name] = h.atomicCopy()
+	}
+	return snapshot
+}
@@ -0,0 +1,39 @@
+package histogram
+
+import (
+	"math"
+	"sort"
+)
+
+// WithReservoir option retains the first size raw samples inserted with Increment,
+// allowing ExactQuantile to compute exact quantiles while all samples are retained.
+// It costs 8 bytes per retained sample, and Clear empties the reservoir.
+func WithReservoir(size int) Option {
+	return func(h *Histogram) {
+		if size > 0 {
+			h.reservoirSize = size
+			h.reservoir = make([]int64, 0, size)
+		}
+	}
+}
+
+// ExactQuantile method returns the exact quantile computed from the reservoir if it holds
+// all samples of the histogram, otherwise it falls back to Quantile and exact is false.
+// Samples added by AtomicIncrement or other histograms are never in the reservoir.
+func (h *Histogram) ExactQuantile(q float64) (value int64, exact bool) {
+	if h.numSamples > 0 && int64(len(h.reservoir)) == h.numSamples && q >= 0 && q <= 1 {
+		samples := make([]int64, len(h.reservoir))
+		copy(samples, h.reservoir)
+		sort.Slice(samples, func(i, j int) bool {
+			return samples[i] < samples[j]
+		})
+		// Nearest rank, the smallest sample with at least q fraction of samples at or below it
+		rank := int(math.Ceil(q*float64(len(samples)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return samples[rank], true
+	}
+	value, _ = h.Quantile(q)
+	return value, false
+}
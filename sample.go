@@ -0,0 +1,61 @@
+package histogram
+
+import "math/rand"
+
+// Sample method draws a random value from the distribution recorded by the histogram.
+// A bucket is picked with probability proportional to its count and the value is uniformly
+// distributed within its range, samples of the open ended first and last buckets are
+// returned as the value of the bucket closest to its finite boundary. It returns 0 if the
+// histogram is empty.
+func (h *Histogram) Sample(r *rand.Rand) int64 {
+	var count int64
+	for _, bucketCount := range h.bucketCounts {
+		if bucketCount > 0 {
+			count += bucketCount
+		}
+	}
+	if count <= 0 {
+		return 0
+	}
+	return h.sample(r, r.Int63n(count))
+}
+
+// SampleN method draws n random values from the histogram, as if Sample were called n times
+func (h *Histogram) SampleN(r *rand.Rand, n int) []int64 {
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = h.Sample(r)
+	}
+	return samples
+}
+
+// sample returns a random value in the bucket holding the sample with given rank,
+// counting only the buckets with positive counts
+func (h *Histogram) sample(r *rand.Rand, rank int64) int64 {
+	for i, count := range h.bucketCounts {
+		if count <= 0 {
+			continue
+		}
+		if rank >= count {
+			rank -= count
+			continue
+		}
+		low, high := h.BucketRanges(i)
+		if h.upperClosed {
+			// Bucket holds (low, high], the open ended buckets are (-inf, high] and (low, +inf)
+			if i == 0 {
+				return high
+			} else if i == len(h.bucketBoundaries) {
+				return low + 1
+			}
+			return low + 1 + r.Int63n(high-low)
+		}
+		if i == 0 {
+			return high - 1
+		} else if i == len(h.bucketBoundaries) {
+			return low
+		}
+		return low + r.Int63n(high-low)
+	}
+	panic("rank out of bound")
+}
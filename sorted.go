@@ -0,0 +1,40 @@
+package histogram
+
+import (
+	"bufio"
+	"io"
+)
+
+// IncrementSortedFrom method inserts the samples parsed from each line of r, which must be in
+// ascending order. Instead of a binary search per sample it advances through the buckets as the
+// samples grow, so inserting n samples takes O(n + buckets). Empty lines are skipped.
+// Reading stops at the first error of r or parse, or at a sample less than the previous one which
+// returns an error, and the samples before it remain in the histogram.
+func (h *Histogram) IncrementSortedFrom(r io.Reader, parse func([]byte) (int64, error)) error {
+	scanner := bufio.NewScanner(r)
+	index := 0
+	first := true
+	var previous int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		val, err := parse(line)
+		if err != nil {
+			return err
+		}
+		if !first && val < previous {
+			return unsortedError
+		}
+		first, previous = false, val
+		if h.clampValues {
+			val = h.clamp(val)
+		}
+		for index < len(h.bucketBoundaries) && (h.bucketBoundaries[index] < val || !h.upperClosed && h.bucketBoundaries[index] == val) {
+			index++
+		}
+		h.incrementBucket(index, val)
+	}
+	return scanner.Err()
+}
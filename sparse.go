@@ -0,0 +1,106 @@
+package histogram
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// MarshalSparse method encodes the histogram storing only non-empty buckets.
+// The encoding is a sequence of varints: number of boundaries, the boundaries,
+// number of samples, total, number of non-empty buckets and an (index, count, total)
+// triple for each non-empty bucket.
+func (h *Histogram) MarshalSparse() ([]byte, error) {
+	if h.upperClosed {
+		return nil, upperClosedError
+	}
+	var buf bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+	writeUvarint := func(value uint64) {
+		buf.Write(scratch[:binary.PutUvarint(scratch[:], value)])
+	}
+	writeVarint := func(value int64) {
+		buf.Write(scratch[:binary.PutVarint(scratch[:], value)])
+	}
+	writeUvarint(uint64(len(h.bucketBoundaries)))
+	for _, boundary := range h.bucketBoundaries {
+		writeVarint(boundary)
+	}
+	writeVarint(h.numSamples)
+	writeVarint(h.total)
+	var nonEmpty uint64
+	for i := range h.bucketCounts {
+		if h.bucketCounts[i] != 0 || h.bucketTotals[i] != 0 {
+			nonEmpty++
+		}
+	}
+	writeUvarint(nonEmpty)
+	for i := range h.bucketCounts {
+		if h.bucketCounts[i] != 0 || h.bucketTotals[i] != 0 {
+			writeUvarint(uint64(i))
+			writeVarint(h.bucketCounts[i])
+			writeVarint(h.bucketTotals[i])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalSparse method decodes the format produced by MarshalSparse into the histogram.
+// An error is returned if the encoded number of samples or total differs from the sums of the buckets.
+func (h *Histogram) UnmarshalSparse(data []byte) error {
+	r := bytes.NewReader(data)
+	numBoundaries, err := binary.ReadUvarint(r)
+	if err != nil || numBoundaries > uint64(r.Len()) {
+		return invalidFormatError
+	}
+	bucketBoundaries := make([]int64, numBoundaries)
+	for i := range bucketBoundaries {
+		if bucketBoundaries[i], err = binary.ReadVarint(r); err != nil {
+			return invalidFormatError
+		}
+	}
+	if err := validateBoundaries(bucketBoundaries); err != nil {
+		return err
+	}
+	numSamples, err := binary.ReadVarint(r)
+	if err != nil {
+		return invalidFormatError
+	}
+	total, err := binary.ReadVarint(r)
+	if err != nil {
+		return invalidFormatError
+	}
+	nonEmpty, err := binary.ReadUvarint(r)
+	if err != nil || nonEmpty > numBoundaries+1 {
+		return invalidFormatError
+	}
+	bucketCounts := make([]int64, numBoundaries+1)
+	bucketTotals := make([]int64, numBoundaries+1)
+	next := uint64(0)
+	for i := uint64(0); i < nonEmpty; i++ {
+		// Indices must be strictly increasing and within the buckets
+		index, err := binary.ReadUvarint(r)
+		if err != nil || index < next || index > numBoundaries {
+			return invalidFormatError
+		}
+		next = index + 1
+		if bucketCounts[index], err = binary.ReadVarint(r); err != nil {
+			return invalidFormatError
+		}
+		if bucketTotals[index], err = binary.ReadVarint(r); err != nil {
+			return invalidFormatError
+		}
+	}
+	if r.Len() != 0 {
+		return invalidFormatError
+	}
+	// Number of samples and total must agree with the buckets they are recomputed from
+	var sumCounts, sumTotals int64
+	for i := range bucketCounts {
+		sumCounts += bucketCounts[i]
+		sumTotals += bucketTotals[i]
+	}
+	if sumCounts != numSamples || sumTotals != total {
+		return inconsistentSumError
+	}
+	return h.setBuckets(bucketBoundaries, bucketCounts, bucketTotals)
+}
@@ -0,0 +1,140 @@
+package histogram
+
+import "math"
+
+// midpoint method returns the middle of the range of a finite bucket
+func (h *Histogram) midpoint(index int) float64 {
+	low, high := h.BucketRanges(index)
+	return float64(low) + float64(high-low)/2
+}
+
+// CenterOfMass method returns the average of the bucket midpoints weighted by their counts.
+// Unlike Average it ignores the bucket totals and only uses the finite buckets.
+// ok is false if there are no samples in the finite buckets.
+func (h *Histogram) CenterOfMass() (center float64, ok bool) {
+	var weighted float64
+	var count int64
+	for i := 1; i < len(h.bucketCounts)-1; i++ {
+		weighted += h.midpoint(i) * float64(h.bucketCounts[i])
+		count += h.bucketCounts[i]
+	}
+	if count <= 0 {
+		return 0, false
+	}
+	return weighted / float64(count), true
+}
+
+// position method returns the representative value of a bucket, which is the midpoint of a
+// finite bucket and the finite boundary of the open ended first and last buckets
+func (h *Histogram) position(index int) float64 {
+	if index == 0 {
+		return float64(h.bucketBoundaries[0])
+	} else if index == len(h.bucketBoundaries) {
+		return float64(h.bucketBoundaries[index-1])
+	}
+	return h.midpoint(index)
+}
+
+// Wasserstein method returns the earth mover's distance between the distributions of both
+// histograms, which is the area between their normalized cumulative distributions.
+// Samples of each bucket are placed at the position of the bucket, the midpoint for finite buckets
+// and the finite boundary for the open ended buckets. Both histograms must have identical
+// bucket boundaries and samples.
+func (h *Histogram) Wasserstein(other *Histogram) (float64, error) {
+	if !h.sameBoundaries(other) {
+		return 0, mismatchError
+	}
+	if h.IsEmpty() || other.IsEmpty() {
+		return 0, noSamplesError
+	}
+	var distance float64
+	var cumulative, otherCumulative int64
+	for i := 0; i < len(h.bucketCounts)-1; i++ {
+		cumulative += h.bucketCounts[i]
+		otherCumulative += other.bucketCounts[i]
+		difference := float64(cumulative)/float64(h.numSamples) - float64(otherCumulative)/float64(other.numSamples)
+		distance += math.Abs(difference) * (h.position(i+1) - h.position(i))
+	}
+	return distance, nil
+}
+
+// ModeValue method estimates the most common value from the bucket with the largest count,
+// the lowest index winning ties. A parabola is fitted through the counts of the bucket and its
+// neighbors and the value at its vertex is returned, which lies within half a bucket width of
+// the midpoint of the bucket. ok is false if the histogram is empty or the bucket is open ended.
+func (h *Histogram) ModeValue() (mode int64, ok bool) {
+	peak := 0
+	for i, count := range h.bucketCounts {
+		if count > h.bucketCounts[peak] {
+			peak = i
+		}
+	}
+	if h.bucketCounts[peak] <= 0 || peak == 0 || peak == len(h.bucketBoundaries) {
+		return 0, false
+	}
+	previous := float64(h.bucketCounts[peak-1])
+	count := float64(h.bucketCounts[peak])
+	next := float64(h.bucketCounts[peak+1])
+	var offset float64
+	if curvature := previous - 2*count + next; curvature != 0 {
+		offset = (previous - next) / (2 * curvature)
+	}
+	low, high := h.BucketRanges(peak)
+	return int64(math.Round(h.midpoint(peak) + offset*float64(high-low))), true
+}
+
+// Gini method returns the Gini coefficient of the values of the samples, computed from the Lorenz
+// curve through the cumulative fractions of the bucket counts and totals in bucket order. Samples
+// within a bucket are treated as equal, so inequality within buckets is not included and the
+// coefficient underestimates it for wide buckets. It is 0 if all samples have equal values, and
+// returns 0 if the histogram is empty or the total is not positive.
+func (h *Histogram) Gini() float64 {
+	if h.IsEmpty() || h.total <= 0 {
+		return 0
+	}
+	var area, previousCount, previousTotal float64
+	var count, total int64
+	for i := range h.bucketCounts {
+		count += h.bucketCounts[i]
+		total += h.bucketTotals[i]
+		countFraction := float64(count) / float64(h.numSamples)
+		totalFraction := float64(total) / float64(h.total)
+		// Trapezoid under the Lorenz curve for this bucket
+		area += (countFraction - previousCount) * (totalFraction + previousTotal) / 2
+		previousCount, previousTotal = countFraction, totalFraction
+	}
+	return 1 - 2*area
+}
+
+// EstimateTotalsFromMidpoints method replaces the bucket totals with estimates from the bucket
+// counts, for histograms whose counts are trusted but totals are not. Each bucket total becomes
+// its count times the midpoint of the bucket rounded to the nearest integer, using the finite
+// boundary for the open ended buckets, and the total is recomputed from them. Average and
+// BucketAverage then return midpoint based estimates.
+func (h *Histogram) EstimateTotalsFromMidpoints() {
+	h.total = 0
+	for i, count := range h.bucketCounts {
+		h.bucketTotals[i] = int64(math.Round(float64(count) * h.position(i)))
+		h.total += h.bucketTotals[i]
+	}
+}
+
+// PeakToAverageRatio method returns the peak value divided by Average. The peak is the largest
+// sample retained by WithTopK if any, otherwise it is estimated as the midpoint of the highest
+// non-empty bucket, or its finite boundary if it is open ended. It returns 0 if the histogram is
+// empty or the average is 0.
+func (h *Histogram) PeakToAverageRatio() float64 {
+	average := h.Average()
+	if h.IsEmpty() || average == 0 {
+		return 0
+	}
+	if len(h.topValues) > 0 {
+		return float64(h.TopK()[0]) / average
+	}
+	for i := len(h.bucketCounts) - 1; i >= 0; i-- {
+		if h.bucketCounts[i] > 0 {
+			return h.position(i) / average
+		}
+	}
+	return 0
+}
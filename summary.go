@@ -0,0 +1,57 @@
+package histogram
+
+// Summary holds the common statistics of a histogram.
+// Min, Max and the percentiles are estimated from the buckets like Quantile.
+type Summary struct {
+	Count  int64
+	Total  int64
+	Mean   float64
+	Min    int64
+	Max    int64
+	P50    int64
+	P90    int64
+	P99    int64
+	StdDev float64
+}
+
+// Summary method returns the common statistics of the histogram, estimating all
+// quantiles with a single walk over the buckets. It is zero if the histogram is empty.
+func (h *Histogram) Summary() Summary {
+	if h.IsEmpty() {
+		return Summary{}
+	}
+	quantiles := []float64{0, 0.5, 0.9, 0.99, 1}
+	values := make([]int64, len(quantiles))
+	var cumulative int64
+	last, next := 0, 0
+	for i, count := range h.bucketCounts {
+		if count <= 0 {
+			continue
+		}
+		for next < len(quantiles) {
+			rank := quantiles[next] * float64(h.numSamples)
+			if float64(cumulative+count) < rank {
+				break
+			}
+			values[next] = h.interpolate(i, (rank-float64(cumulative))/float64(count))
+			next++
+		}
+		cumulative += count
+		last = i
+	}
+	// Bucket counts add up to less than number of samples, use the highest non-empty bucket
+	for ; next < len(quantiles); next++ {
+		values[next] = h.interpolate(last, 1)
+	}
+	return Summary{
+		Count:  h.numSamples,
+		Total:  h.total,
+		Mean:   h.Average(),
+		Min:    values[0],
+		P50:    values[1],
+		P90:    values[2],
+		P99:    values[3],
+		Max:    values[4],
+		StdDev: h.StdDev(),
+	}
+}
@@ -0,0 +1,48 @@
+package histogram
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// svgFill is the fill of the bars of finite buckets, svgOpenFill of the open ended buckets
+	svgFill     = "#4878d0"
+	svgOpenFill = "#a0a0a0"
+)
+
+// WriteSVG method writes the bucket counts as an SVG bar chart of width by height pixels for inline
+// use. Every bucket gets a bar of equal width regardless of its range, the tallest bar spans the full
+// height and the others are scaled to it, and the open ended buckets are drawn in a lighter fill.
+// Each bar has a title with its range and count shown as a tooltip. Width and height must be positive.
+func (h *Histogram) WriteSVG(w io.Writer, width, height int) error {
+	if width <= 0 || height <= 0 {
+		return invalidArgumentError
+	}
+	var maxCount int64
+	for _, count := range h.bucketCounts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	barWidth := float64(width) / float64(len(h.bucketCounts))
+	for i, count := range h.bucketCounts {
+		barHeight := 0.0
+		if count > 0 {
+			barHeight = float64(height) * float64(count) / float64(maxCount)
+		}
+		fill := svgFill
+		if i == 0 || i == len(h.bucketBoundaries) {
+			fill = svgOpenFill
+		}
+		fmt.Fprintf(&buf, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"><title>%s %d</title></rect>`,
+			float64(i)*barWidth, float64(height)-barHeight, barWidth, barHeight, fill, h.formatRange(i), count)
+	}
+	buf.WriteString("</svg>\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,25 @@
+package histogram
+
+// Template creates empty histograms sharing bucket boundaries, labels and options,
+// so that every histogram created from it can be merged with the others.
+type Template struct {
+	prototype *Histogram
+}
+
+func NewTemplate(bucketBoundaries []int64, opts ...Option) (*Template, error) {
+	prototype, err := New(bucketBoundaries, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{prototype: prototype}, nil
+}
+
+// SetLabels method sets the bucket labels of histograms created afterwards
+func (t *Template) SetLabels(labels []string) error {
+	return t.prototype.SetLabels(labels)
+}
+
+// New method creates an empty histogram from the template
+func (t *Template) New() *Histogram {
+	return t.prototype.Copy()
+}
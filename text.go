@@ -0,0 +1,71 @@
+package histogram
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// MarshalText method encodes the histogram in a compact single-line format
+// boundaries=1,2,3;counts=0,1,2,1;totals=0,1,4,3
+func (h *Histogram) MarshalText() ([]byte, error) {
+	if h.upperClosed {
+		return nil, upperClosedError
+	}
+	var buf bytes.Buffer
+	buf.WriteString("boundaries=")
+	writeInt64s(&buf, h.bucketBoundaries)
+	buf.WriteString(";counts=")
+	writeInt64s(&buf, h.bucketCounts)
+	buf.WriteString(";totals=")
+	writeInt64s(&buf, h.bucketTotals)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText method decodes the format produced by MarshalText into the histogram.
+// Number of samples and total are recomputed from the bucket counts and totals.
+func (h *Histogram) UnmarshalText(text []byte) error {
+	fields := strings.Split(string(text), ";")
+	if len(fields) != 3 {
+		return invalidFormatError
+	}
+	var values [3][]int64
+	for i, key := range []string{"boundaries", "counts", "totals"} {
+		if !strings.HasPrefix(fields[i], key+"=") {
+			return invalidFormatError
+		}
+		parsed, err := parseInt64s(strings.TrimPrefix(fields[i], key+"="))
+		if err != nil {
+			return err
+		}
+		values[i] = parsed
+	}
+	return h.setBuckets(values[0], values[1], values[2])
+}
+
+// writeInt64s writes values separated by commas
+func writeInt64s(buf *bytes.Buffer, values []int64) {
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.FormatInt(value, 10))
+	}
+}
+
+// parseInt64s parses comma separated values, an empty string is an empty slice
+func parseInt64s(s string) ([]int64, error) {
+	if s == "" {
+		return []int64{}, nil
+	}
+	parts := strings.Split(s, ",")
+	values := make([]int64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, invalidFormatError
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,57 @@
+package histogram
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// WithTopK option retains the k largest raw samples inserted with Increment in a min-heap,
+// so TopK can show the actual values behind the overflow bucket. It costs 8 bytes per retained
+// sample and O(log k) per Increment, and Clear empties the heap.
+func WithTopK(k int) Option {
+	return func(h *Histogram) {
+		if k > 0 {
+			h.topK = k
+			h.topValues = make(minHeap, 0, k)
+		}
+	}
+}
+
+// TopK method returns the largest samples retained by WithTopK in descending order.
+// Samples added by AtomicIncrement or other histograms are never retained.
+func (h *Histogram) TopK() []int64 {
+	values := make([]int64, len(h.topValues))
+	copy(values, h.topValues)
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] > values[j]
+	})
+	return values
+}
+
+// recordTopK method keeps val if it is among the largest topK samples
+func (h *Histogram) recordTopK(val int64) {
+	if len(h.topValues) < h.topK {
+		heap.Push(&h.topValues, val)
+	} else if val > h.topValues[0] {
+		h.topValues[0] = val
+		heap.Fix(&h.topValues, 0)
+	}
+}
+
+// minHeap is a heap.Interface of int64 with the smallest value at index 0
+type minHeap []int64
+
+func (m minHeap) Len() int           { return len(m) }
+func (m minHeap) Less(i, j int) bool { return m[i] < m[j] }
+func (m minHeap) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+func (m *minHeap) Push(x interface{}) {
+	*m = append(*m, x.(int64))
+}
+
+func (m *minHeap) Pop() interface{} {
+	old := *m
+	x := old[len(old)-1]
+	*m = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,43 @@
+package histogram
+
+// TrackedHistogram aggregates histograms from named sources and records the number of samples
+// each source contributed, to find the source behind an anomaly in the aggregate.
+// All operations are not thread-safe.
+type TrackedHistogram struct {
+	h             *Histogram
+	contributions map[string]int64
+}
+
+func NewTrackedHistogram(bucketBoundaries []int64, opts ...Option) (*TrackedHistogram, error) {
+	h, err := New(bucketBoundaries, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackedHistogram{h: h, contributions: make(map[string]int64)}, nil
+}
+
+// IncrementFromHistogram method includes all the samples of other histogram into the aggregate and
+// adds its number of samples to the contribution of source name. An error is returned without
+// changing the aggregate if the bucket boundaries of other differ.
+func (t *TrackedHistogram) IncrementFromHistogram(name string, other *Histogram) error {
+	if !t.h.sameBoundaries(other) {
+		return mismatchError
+	}
+	t.h.IncrementFromHistogram(other)
+	t.contributions[name] += other.numSamples
+	return nil
+}
+
+// Contributions method returns a copy of the number of samples contributed by each source
+func (t *TrackedHistogram) Contributions() map[string]int64 {
+	contributions := make(map[string]int64, len(t.contributions))
+	for name, count := range t.contributions {
+		contributions[name] = count
+	}
+	return contributions
+}
+
+// Histogram method returns the aggregate of all sources
+func (t *TrackedHistogram) Histogram() *Histogram {
+	return t.h
+}
@@ -0,0 +1,130 @@
+package histogram
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// UnsignedHistogram is a histogram with uint64 counts, doubling the number of samples
+// before counts overflow. Totals stay int64 since values may be negative.
+// Counts never decrease, so it has no methods to decrement or remove samples.
+// All operations are not thread-safe except AtomicIncrement.
+type UnsignedHistogram struct {
+	// Values in half-open range [bucketBoundaries[i-1], bucketBoundaries[i])
+	// will be stored in bucket[i]
+	bucketBoundaries []int64
+	bucketCounts     []uint64
+	bucketTotals     []int64
+	numSamples       uint64
+	total            int64
+}
+
+func NewUnsigned(bucketBoundaries []int64) (*UnsignedHistogram, error) {
+	if err := validateBoundaries(bucketBoundaries); err != nil {
+		return nil, err
+	}
+	boundaries := make([]int64, len(bucketBoundaries))
+	copy(boundaries, bucketBoundaries)
+	return &UnsignedHistogram{
+		bucketBoundaries: boundaries,
+		bucketCounts:     make([]uint64, len(bucketBoundaries)+1),
+		bucketTotals:     make([]int64, len(bucketBoundaries)+1),
+	}, nil
+}
+
+// BucketIndex method returns the index of the bucket the value falls into
+func (h *UnsignedHistogram) BucketIndex(val int64) int {
+	return sort.Search(len(h.bucketBoundaries), func(i int) bool {
+		return h.bucketBoundaries[i] > val
+	})
+}
+
+// Increment method inserts a sample into the histogram
+func (h *UnsignedHistogram) Increment(val int64) {
+	index := h.BucketIndex(val)
+	h.bucketCounts[index]++
+	h.bucketTotals[index] += val
+	h.numSamples++
+	h.total += val
+}
+
+// AtomicIncrement method inserts a sample into the histogram in thread safe manner
+func (h *UnsignedHistogram) AtomicIncrement(val int64) {
+	index := h.BucketIndex(val)
+	atomic.AddUint64(&h.bucketCounts[index], 1)
+	atomic.AddInt64(&h.bucketTotals[index], val)
+	atomic.AddUint64(&h.numSamples, 1)
+	atomic.AddInt64(&h.total, val)
+}
+
+// IncrementFromHistogram method includes all the samples of other histogram into this.
+// This bucketBoundaries used to construct other histogram must be identical to this.
+func (h *UnsignedHistogram) IncrementFromHistogram(other *UnsignedHistogram) {
+	if !equalBoundaries(h.bucketBoundaries, other.bucketBoundaries) {
+		panic("Mismatch in bucketBoundaries")
+	}
+	for i := range h.bucketCounts {
+		h.bucketCounts[i] += other.bucketCounts[i]
+		h.bucketTotals[i] += other.bucketTotals[i]
+	}
+	h.numSamples += other.numSamples
+	h.total += other.total
+}
+
+// BucketRanges method returns the low and high boundaries of this bucket.
+func (h *UnsignedHistogram) BucketRanges(index int) (int64, int64) {
+	if index < 0 || index > len(h.bucketBoundaries) {
+		panic("index out of bound")
+	}
+	if index == 0 {
+		return math.MinInt64, h.bucketBoundaries[index]
+	} else if index == len(h.bucketBoundaries) {
+		return h.bucketBoundaries[index-1], math.MaxInt64
+	} else {
+		return h.bucketBoundaries[index-1], h.bucketBoundaries[index]
+	}
+}
+
+// BucketCount method returns the number of increments that went into this bucket
+func (h *UnsignedHistogram) BucketCount(index int) uint64 {
+	return h.bucketCounts[index]
+}
+
+// BucketTotal method returns the total of all values inserted to a particular bucket
+func (h *UnsignedHistogram) BucketTotal(index int) int64 {
+	return h.bucketTotals[index]
+}
+
+// Size method returns the number of buckets
+func (h *UnsignedHistogram) Size() int {
+	return len(h.bucketCounts)
+}
+
+// Count method returns the total number of samples in all buckets
+func (h *UnsignedHistogram) Count() uint64 {
+	return h.numSamples
+}
+
+// Total method returns the sum of all samples inserted into the histogram
+func (h *UnsignedHistogram) Total() int64 {
+	return h.total
+}
+
+// Average method returns the average of all values inserted
+func (h *UnsignedHistogram) Average() float64 {
+	if h.numSamples == 0 {
+		return 0
+	}
+	return float64(h.total) / float64(h.numSamples)
+}
+
+// Clear method zeros out the buckets
+func (h *UnsignedHistogram) Clear() {
+	for i := range h.bucketCounts {
+		h.bucketCounts[i] = 0
+		h.bucketTotals[i] = 0
+	}
+	h.numSamples = 0
+	h.total = 0
+}
@@ -0,0 +1,28 @@
+package histogram
+
+import "io"
+
+// SizeHistogram is an io.Writer which records the length of each write into a histogram
+// before passing it to the wrapped writer. A nil writer discards the writes.
+type SizeHistogram struct {
+	w io.Writer
+	h *Histogram
+}
+
+func NewSizeHistogram(w io.Writer, h *Histogram) *SizeHistogram {
+	return &SizeHistogram{w: w, h: h}
+}
+
+// Write method records len(p) with Increment and writes p to the wrapped writer
+func (s *SizeHistogram) Write(p []byte) (int, error) {
+	s.h.Increment(int64(len(p)))
+	if s.w == nil {
+		return len(p), nil
+	}
+	return s.w.Write(p)
+}
+
+// Histogram method returns the histogram of write sizes
+func (s *SizeHistogram) Histogram() *Histogram {
+	return s.h
+}